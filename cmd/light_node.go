@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"log"
 	"math/big"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -16,6 +18,7 @@ import (
 	"github.com/memoio/meeda-node/core"
 	"github.com/memoio/meeda-node/core/light"
 	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/utils"
 	"github.com/urfave/cli/v2"
 	proof "github.com/memoio/go-did/file-proof"
 )
@@ -33,7 +36,7 @@ var LightNodeCmd = &cli.Command{
 var lightNodeRunCmd = &cli.Command{
 	Name:  "run",
 	Usage: "run meeda light node",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:    "endpoint",
 			Aliases: []string{"e"},
@@ -60,6 +63,59 @@ var lightNodeRunCmd = &cli.Command{
 			Usage: "input the old meeda store node's ip address",
 			Value: "",
 		},
+		&cli.Int64Flag{
+			Name:  "max-size",
+			Usage: "input the maximum size of data in bytes, 0 means the size the srs can commit",
+			Value: 0,
+		},
+		&cli.Int64Flag{
+			Name:  "max-large-size",
+			Usage: "input the maximum size of data in bytes put in large mode",
+			Value: 64 << 20,
+		},
+		&cli.StringSliceFlag{
+			Name:  "api-key",
+			Usage: "input the api keys accepted to put objects, the api is open if no authentication is set",
+		},
+		&cli.BoolFlag{
+			Name:  "signed-auth",
+			Usage: "accept the requests signed by ethereum accounts (EIP-191)",
+			Value: false,
+		},
+		&cli.StringSliceFlag{
+			Name:  "allow-uploader",
+			Usage: "input the addresses allowed to put objects by signed requests, which enables signed-auth",
+		},
+		&cli.DurationFlag{
+			Name:  "auth-window",
+			Usage: "input how long a signed request is valid",
+			Value: 5 * time.Minute,
+		},
+		&cli.BoolFlag{
+			Name:  "trust-store",
+			Usage: "let the clients skip the verification of data by the header X-Meeda-Skip-Verify, for the store node trusted",
+			Value: false,
+		},
+		&cli.DurationFlag{
+			Name:  "sample-interval",
+			Usage: "input the interval of sampling the availability of files, 0 disables sampling",
+			Value: 10 * time.Minute,
+		},
+		&cli.IntFlag{
+			Name:  "sample-files",
+			Usage: "input how many files are sampled every interval",
+			Value: 8,
+		},
+		&cli.StringFlag{
+			Name:  "altda-endpoint",
+			Usage: "input the endpoint serving the alt-DA server protocol of OP-Stack, e.g.(127.0.0.1:3100), whose requests are not authenticated",
+			Value: "",
+		},
+		&cli.BoolFlag{
+			Name:  "altda-public",
+			Usage: "let the alt-DA endpoint listen on an address other than loopback, everyone reaching it can put data",
+			Value: false,
+		},
 		&cli.StringFlag{
 			Name:  "pledge",
 			Usage: "input pledge contract address",
@@ -80,7 +136,7 @@ var lightNodeRunCmd = &cli.Command{
 			Usage: "input proofProxy contract address",
 			Value: "",
 		},
-	},
+	}, quotaFlags...),
 	Action: func(ctx *cli.Context) error {
 		endPoint := ctx.String("endpoint")
 		sk := ctx.String("sk")
@@ -93,6 +149,11 @@ var lightNodeRunCmd = &cli.Command{
 		proofControl := ctx.String("proofcontrol")
 		proofProxy := ctx.String("proofproxy")
 
+		err := checkAltDAEndpoint(ctx.String("altda-endpoint"), ctx.Bool("altda-public"))
+		if err != nil {
+			return err
+		}
+
 		privateKey, err := crypto.HexToECDSA(sk)
 		if err != nil {
 			privateKey, err = crypto.GenerateKey()
@@ -115,11 +176,26 @@ var lightNodeRunCmd = &cli.Command{
 		if err != nil {
 			return err
 		}
+		light.SetMaxDataSize(ctx.Int64("max-size"), ctx.Int64("max-large-size"))
+		light.SetAuthenticator(authenticatorFromFlags(ctx))
+		light.SetTrustStore(ctx.Bool("trust-store"))
 		err = database.InitDatabase("~/.meeda-light")
 		if err != nil {
 			return err
 		}
 
+		err = light.StartPutJobs(cctx, "~/.meeda-light/jobs")
+		if err != nil {
+			return err
+		}
+		go light.RetryAddFiles(cctx)
+
+		quota := quotaFromFlags(ctx)
+		light.SetQuota(quota)
+		if quota != nil {
+			go quota.Prune(cctx)
+		}
+
 		dumper, err := core.NewDataAvailabilityDumper(chain, addrs)
 		if err != nil {
 			return err
@@ -130,6 +206,9 @@ var lightNodeRunCmd = &cli.Command{
 			return err
 		}
 		go dumper.SubscribeFileProof(cctx)
+		if interval := ctx.Duration("sample-interval"); interval > 0 {
+			go light.SampleDataAvailability(cctx, interval, ctx.Int("sample-files"))
+		}
 
 		prover, err := light.NewDataAvailabilityProver(chain, privateKey, addrs)
 		if err != nil {
@@ -163,6 +242,16 @@ var lightNodeRunCmd = &cli.Command{
 			}
 		}()
 
+		var altDASrv *http.Server
+		if altDAEndpoint := ctx.String("altda-endpoint"); altDAEndpoint != "" {
+			altDASrv = NewAltDAServer(altDAEndpoint)
+			go func() {
+				if err := altDASrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Fatalf("listen: %s\n", err)
+				}
+			}()
+		}
+
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 		<-quit
@@ -171,6 +260,11 @@ var lightNodeRunCmd = &cli.Command{
 		if err := srv.Shutdown(cctx); err != nil {
 			log.Fatal("Server forced to shutdown: ", err)
 		}
+		if altDASrv != nil {
+			if err := altDASrv.Shutdown(cctx); err != nil {
+				log.Fatal("Server forced to shutdown: ", err)
+			}
+		}
 
 		log.Println("Server exiting")
 
@@ -229,6 +323,33 @@ var queryProfitsCmd = &cli.Command{
 	},
 }
 
+// authenticatorFromFlags returns nil if no authentication is set
+func authenticatorFromFlags(ctx *cli.Context) utils.Authenticator {
+	var auths utils.AnyOf
+	if keys := ctx.StringSlice("api-key"); len(keys) > 0 {
+		auths = append(auths, utils.APIKeys(keys))
+	}
+
+	allowed := make(map[common.Address]bool)
+	for _, addr := range ctx.StringSlice("allow-uploader") {
+		allowed[common.HexToAddress(addr)] = true
+	}
+	if ctx.Bool("signed-auth") || len(allowed) > 0 {
+		auths = append(auths, &utils.SignedRequests{
+			Window:  ctx.Duration("auth-window"),
+			Allowed: allowed,
+			// the hex encoded json doubles the size of data
+			MaxBody: 2*ctx.Int64("max-large-size") + 1<<20,
+		})
+	}
+
+	if len(auths) == 0 {
+		log.Println("the light node api is open to everyone, set api-key or signed-auth to protect it")
+		return nil
+	}
+	return auths
+}
+
 func NewLightServer(endpoint string) (*http.Server, error) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
@@ -246,3 +367,34 @@ func NewLightServer(endpoint string) (*http.Server, error) {
 		Handler: router,
 	}, nil
 }
+
+// NewAltDAServer serves the alt-DA server protocol for op-node and
+// op-batcher
+// checkAltDAEndpoint refuses the alt-DA endpoint which is not on loopback
+// unless it is public, since its requests are not authenticated
+func checkAltDAEndpoint(endpoint string, public bool) error {
+	if endpoint == "" || public {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("alt-DA endpoint %s is not on loopback, set --altda-public to serve it anyway", endpoint)
+}
+
+func NewAltDAServer(endpoint string) *http.Server {
+	router := gin.Default()
+	light.LoadAltDAModule(router.Group("/"))
+
+	return &http.Server{
+		Addr:    endpoint,
+		Handler: router,
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/memoio/meeda-node/core"
+	"github.com/urfave/cli/v2"
+)
+
+var quotaFlags = []cli.Flag{
+	&cli.DurationFlag{
+		Name:  "quota-window",
+		Usage: "input the sliding window the quota of every account is counted in",
+		Value: time.Hour,
+	},
+	&cli.Int64Flag{
+		Name:  "quota-put-requests",
+		Usage: "input the maximum putObject requests of an account in the window, 0 means no limit",
+		Value: 0,
+	},
+	&cli.Int64Flag{
+		Name:  "quota-put-bytes",
+		Usage: "input the maximum bytes an account puts in the window, 0 means no limit",
+		Value: 0,
+	},
+	&cli.Int64Flag{
+		Name:  "quota-get-requests",
+		Usage: "input the maximum getObject requests of an account in the window, 0 means no limit",
+		Value: 0,
+	},
+	&cli.Int64Flag{
+		Name:  "quota-get-bytes",
+		Usage: "input the maximum bytes an account gets in the window, 0 means no limit",
+		Value: 0,
+	},
+}
+
+// quotaFromFlags returns nil if no limit is set
+func quotaFromFlags(ctx *cli.Context) *core.Quota {
+	limits := map[string]core.QuotaLimit{
+		"putObject": {
+			Requests: ctx.Int64("quota-put-requests"),
+			Bytes:    ctx.Int64("quota-put-bytes"),
+		},
+		"getObject": {
+			Requests: ctx.Int64("quota-get-requests"),
+			Bytes:    ctx.Int64("quota-get-bytes"),
+		},
+	}
+	for _, limit := range limits {
+		if limit.Requests > 0 || limit.Bytes > 0 {
+			return &core.Quota{
+				Window: ctx.Duration("quota-window"),
+				Limits: limits,
+			}
+		}
+	}
+	return nil
+}
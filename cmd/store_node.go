@@ -1,180 +1,396 @@
-package cmd
-
-import (
-	"context"
-	"log"
-	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
-
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/gin-gonic/gin"
-	proof "github.com/memoio/go-did/file-proof"
-	"github.com/memoio/meeda-node/core"
-	"github.com/memoio/meeda-node/core/store"
-	"github.com/memoio/meeda-node/database"
-	"github.com/urfave/cli/v2"
-)
-
-var StoreNodeCmd = &cli.Command{
-	Name:  "store",
-	Usage: "meeda store node",
-	Subcommands: []*cli.Command{
-		storeNodeRunCmd,
-		// storeNodeStopCmd,
-	},
-}
-
-var storeNodeRunCmd = &cli.Command{
-	Name:  "run",
-	Usage: "run meeda store node",
-	Flags: []cli.Flag{
-		&cli.StringFlag{
-			Name:    "endpoint",
-			Aliases: []string{"e"},
-			Usage:   "input your endpoint",
-			Value:   ":8081",
-		},
-		&cli.StringFlag{
-			Name:  "sk",
-			Usage: "input your private key",
-			Value: "",
-		},
-		&cli.StringFlag{
-			Name:  "chain",
-			Usage: "input chain name, e.g.(dev)",
-			Value: "product",
-		},
-		&cli.StringFlag{
-			Name:  "ip",
-			Usage: "input mefs user's ip",
-			Value: "",
-		},
-		&cli.StringFlag{
-			Name:  "token",
-			Usage: "input mefs user's token",
-			Value: "",
-		},
-		&cli.StringFlag{
-			Name:  "pledge",
-			Usage: "input pledge contract address",
-			Value: "",
-		},
-		&cli.StringFlag{
-			Name:  "fileproof",
-			Usage: "input fileproof contract address",
-			Value: "",
-		},
-		&cli.StringFlag{
-			Name:  "proofcontrol",
-			Usage: "input proofControl contract address",
-			Value: "",
-		},
-		&cli.StringFlag{
-			Name:  "proofproxy",
-			Usage: "input proofProxy contract address",
-			Value: "",
-		},
-	},
-	Action: func(ctx *cli.Context) error {
-		endPoint := ctx.String("endpoint")
-		sk := ctx.String("sk")
-		chain := ctx.String("chain")
-		ip := ctx.String("ip")
-		token := ctx.String("token")
-
-		pledge := ctx.String("pledge")
-		fileproof := ctx.String("fileproof")
-		proofControl := ctx.String("proofcontrol")
-		proofProxy := ctx.String("proofproxy")
-
-		privateKey, err := crypto.HexToECDSA(sk)
-		if err != nil {
-			privateKey, err = crypto.GenerateKey()
-			if err != nil {
-				return err
-			}
-		}
-
-		addrs := &proof.ContractAddress{
-			PledgeAddr:       common.HexToAddress(pledge),
-			ProofAddr:        common.HexToAddress(fileproof),
-			ProofControlAddr: common.HexToAddress(proofControl),
-			ProofProxyAddr:   common.HexToAddress(proofProxy),
-		}
-
-		cctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		err = store.InitStoreNode(chain, privateKey, ip, token, addrs)
-		if err != nil {
-			return err
-		}
-		err = database.InitDatabase("~/.meeda-store")
-		if err != nil {
-			return err
-		}
-
-		dumper, err := core.NewDataAvailabilityDumper(chain, addrs)
-		if err != nil {
-			return err
-		}
-
-		err = dumper.DumpFileProof()
-		if err != nil {
-			return err
-		}
-		go dumper.SubscribeFileProof(cctx)
-
-		prover, err := store.NewDataAvailabilityProver(chain, privateKey, addrs)
-		if err != nil {
-			log.Fatalf("new store node prover: %s\n", err)
-		}
-		err = prover.Pledge()
-		if err != nil {
-			log.Fatalf("store node pledge err: %s\n", err)
-		}
-		go prover.ProveDataAccess(cctx)
-
-		srv, err := NewStoreServer(endPoint)
-		if err != nil {
-			log.Fatalf("new store node server: %s\n", err)
-		}
-
-		go func() {
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				log.Fatalf("listen: %s\n", err)
-			}
-		}()
-
-		quit := make(chan os.Signal, 1)
-		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-		<-quit
-		log.Println("Shutting down server...")
-
-		if err := srv.Shutdown(cctx); err != nil {
-			log.Fatal("Server forced to shutdown: ", err)
-		}
-
-		log.Println("Server exiting")
-		return nil
-	},
-}
-
-func NewStoreServer(endpoint string) (*http.Server, error) {
-	gin.SetMode(gin.ReleaseMode)
-	router := gin.Default()
-
-	router.MaxMultipartMemory = 8 << 20 // 8 MiB
-	router.GET("/", func(c *gin.Context) {
-		c.String(http.StatusOK, "Welcome Meeda Store Node")
-	})
-	store.LoadStoreModule(router.Group("/"))
-
-	return &http.Server{
-		Addr:    endpoint,
-		Handler: router,
-	}, nil
-}
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	proof "github.com/memoio/go-did/file-proof"
+	"github.com/memoio/meeda-node/core"
+	"github.com/memoio/meeda-node/core/store"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/gateway"
+	"github.com/urfave/cli/v2"
+)
+
+var StoreNodeCmd = &cli.Command{
+	Name:  "store",
+	Usage: "meeda store node",
+	Subcommands: []*cli.Command{
+		storeNodeRunCmd,
+		storeNodeReconcileCmd,
+		// storeNodeStopCmd,
+	},
+}
+
+var storeNodeRunCmd = &cli.Command{
+	Name:  "run",
+	Usage: "run meeda store node",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "endpoint",
+			Aliases: []string{"e"},
+			Usage:   "input your endpoint",
+			Value:   ":8081",
+		},
+		&cli.StringFlag{
+			Name:  "sk",
+			Usage: "input your private key",
+			Value: "",
+		},
+		&cli.StringFlag{
+			Name:  "chain",
+			Usage: "input chain name, e.g.(dev)",
+			Value: "product",
+		},
+		repoFlag,
+	}, append(append(storageFlags,
+		&cli.StringFlag{
+			Name:  "cache-path",
+			Usage: "input the directory of blob cache",
+			Value: "~/.meeda-store/cache",
+		},
+		&cli.Int64Flag{
+			Name:  "cache-size",
+			Usage: "input the capacity of blob cache in MiB, 0 disables the cache",
+			Value: 0,
+		},
+		&cli.DurationFlag{
+			Name:  "gc-grace",
+			Usage: "input how long expired blobs are kept before deleted",
+			Value: 24 * time.Hour,
+		},
+		&cli.DurationFlag{
+			Name:  "gc-interval",
+			Usage: "input the interval of deleting expired blobs, 0 disables it",
+			Value: time.Hour,
+		},
+		&cli.Int64Flag{
+			Name:  "max-size",
+			Usage: "input the maximum size of data in bytes, 0 means the size the srs can commit",
+			Value: 0,
+		},
+		&cli.StringSliceFlag{
+			Name:  "allow-submitter",
+			Usage: "input the addresses allowed to obtain credentials, the submitters on chain are allowed if not set",
+		},
+		&cli.DurationFlag{
+			Name:  "auth-window",
+			Usage: "input how long a signed put request is valid",
+			Value: 5 * time.Minute,
+		},
+		&cli.StringFlag{
+			Name:  "pledge",
+			Usage: "input pledge contract address",
+			Value: "",
+		},
+		&cli.StringFlag{
+			Name:  "fileproof",
+			Usage: "input fileproof contract address",
+			Value: "",
+		},
+		&cli.StringFlag{
+			Name:  "proofcontrol",
+			Usage: "input proofControl contract address",
+			Value: "",
+		},
+		&cli.StringFlag{
+			Name:  "proofproxy",
+			Usage: "input proofProxy contract address",
+			Value: "",
+		},
+	), quotaFlags...)...),
+	Action: func(ctx *cli.Context) error {
+		endPoint := ctx.String("endpoint")
+		sk := ctx.String("sk")
+		chain := ctx.String("chain")
+
+		storeCfg, err := storeConfigFromFlags(ctx)
+		if err != nil {
+			return err
+		}
+
+		pledge := ctx.String("pledge")
+		fileproof := ctx.String("fileproof")
+		proofControl := ctx.String("proofcontrol")
+		proofProxy := ctx.String("proofproxy")
+
+		privateKey, err := crypto.HexToECDSA(sk)
+		if err != nil {
+			privateKey, err = crypto.GenerateKey()
+			if err != nil {
+				return err
+			}
+		}
+
+		addrs := &proof.ContractAddress{
+			PledgeAddr:       common.HexToAddress(pledge),
+			ProofAddr:        common.HexToAddress(fileproof),
+			ProofControlAddr: common.HexToAddress(proofControl),
+			ProofProxyAddr:   common.HexToAddress(proofProxy),
+		}
+
+		cctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		err = store.InitStoreNode(chain, privateKey, storeCfg, addrs)
+		if err != nil {
+			return err
+		}
+		store.SetMaxDataSize(ctx.Int64("max-size"))
+		var allowed []common.Address
+		for _, addr := range ctx.StringSlice("allow-submitter") {
+			allowed = append(allowed, common.HexToAddress(addr))
+		}
+		store.SetCredentialAuth(allowed, ctx.Duration("auth-window"))
+		err = database.InitDatabase(ctx.String("repo"))
+		if err != nil {
+			return err
+		}
+
+		quota := quotaFromFlags(ctx)
+		store.SetQuota(quota)
+		if quota != nil {
+			go quota.Prune(cctx)
+		}
+
+		if cacheSize := ctx.Int64("cache-size"); cacheSize > 0 {
+			err = store.EnableDACache(ctx.String("cache-path"), cacheSize<<20)
+			if err != nil {
+				return err
+			}
+		}
+
+		dumper, err := core.NewDataAvailabilityDumper(chain, addrs)
+		if err != nil {
+			return err
+		}
+
+		err = dumper.DumpFileProof()
+		if err != nil {
+			return err
+		}
+		go dumper.SubscribeFileProof(cctx)
+
+		prover, err := store.NewDataAvailabilityProver(chain, privateKey, addrs)
+		if err != nil {
+			log.Fatalf("new store node prover: %s\n", err)
+		}
+		err = prover.Pledge()
+		if err != nil {
+			log.Fatalf("store node pledge err: %s\n", err)
+		}
+		go prover.ProveDataAccess(cctx)
+		go store.RepairDAStore(cctx)
+		if interval := ctx.Duration("gc-interval"); interval > 0 {
+			go store.CollectExpiredBlobs(cctx, ctx.Duration("gc-grace"), interval)
+		}
+
+		srv, err := NewStoreServer(endPoint)
+		if err != nil {
+			log.Fatalf("new store node server: %s\n", err)
+		}
+
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("listen: %s\n", err)
+			}
+		}()
+
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		<-quit
+		log.Println("Shutting down server...")
+
+		if err := srv.Shutdown(cctx); err != nil {
+			log.Fatal("Server forced to shutdown: ", err)
+		}
+
+		log.Println("Server exiting")
+		return nil
+	},
+}
+
+var storeNodeReconcileCmd = &cli.Command{
+	Name:  "reconcile",
+	Usage: "compare the blobs in storage with the indexed commitments",
+	Flags: append([]cli.Flag{
+		&cli.BoolFlag{
+			Name:  "reindex",
+			Usage: "index the orphaned blobs by their commitments",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "reupload",
+			Usage: "fetch the missing blobs from the source store node and upload them again",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:  "source",
+			Usage: "input the url of the store node to fetch missing blobs from",
+			Value: "",
+		},
+		repoFlag,
+	}, storageFlags...),
+	Action: func(ctx *cli.Context) error {
+		storeCfg, err := storeConfigFromFlags(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = database.InitDatabase(ctx.String("repo"))
+		if err != nil {
+			return err
+		}
+
+		report, err := store.Reconcile(ctx.Context, storeCfg, store.ReconcileOptions{
+			Reindex:  ctx.Bool("reindex"),
+			Reupload: ctx.Bool("reupload"),
+			Source:   ctx.String("source"),
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("objects in storage: %d, indexed commitments: %d\n", report.Objects, report.Indexed)
+		for _, oi := range report.Orphaned {
+			fmt.Printf("orphaned: %s %s (%d bytes)\n", oi.Name, oi.Cid, oi.Size)
+		}
+		for _, fileID := range report.Missing {
+			commit := fileID.Commit.Bytes()
+			fmt.Printf("missing: %s %s\n", hex.EncodeToString(commit[:]), fileID.Mid)
+		}
+		for _, file := range report.Unindexed {
+			commit := file.Commit.Bytes()
+			fmt.Printf("unindexed: %s (%d bytes)\n", hex.EncodeToString(commit[:]), file.Size)
+		}
+		fmt.Printf("orphaned: %d, missing: %d, unindexed: %d, reindexed: %d, reuploaded: %d, failed: %d\n",
+			len(report.Orphaned), len(report.Missing), len(report.Unindexed), report.Reindexed, report.Reuploaded, report.Failed)
+		return nil
+	},
+}
+
+var repoFlag = &cli.StringFlag{
+	Name:  "repo",
+	Usage: "input the directory of the database of store node",
+	Value: "~/.meeda-store",
+}
+
+var storageFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "ip",
+		Usage: "input mefs user's ip, ipfs api address or s3 endpoint",
+		Value: "",
+	},
+	&cli.StringFlag{
+		Name:  "token",
+		Usage: "input mefs user's token",
+		Value: "",
+	},
+	&cli.StringFlag{
+		Name:  "storage",
+		Usage: "input the storage type of blobs, e.g.(mefs, ipfs, s3, qiniu, local, replica)",
+		Value: "mefs",
+	},
+	&cli.StringFlag{
+		Name:  "path",
+		Usage: "input the directory of local storage",
+		Value: "~/.meeda-store/blobs",
+	},
+	&cli.StringFlag{
+		Name:  "access-key",
+		Usage: "input the access key of s3 storage",
+		Value: "",
+	},
+	&cli.StringFlag{
+		Name:    "secret-key",
+		Usage:   "input the secret key of s3 storage",
+		EnvVars: []string{"MEEDA_S3_SECRET_KEY"},
+		Value:   "",
+	},
+	&cli.StringFlag{
+		Name:  "secret-key-file",
+		Usage: "input the file of the secret key of s3 storage, instead of the secret key",
+		Value: "",
+	},
+	&cli.StringFlag{
+		Name:  "region",
+		Usage: "input the region of s3 storage",
+		Value: "us-east-1",
+	},
+	&cli.StringFlag{
+		Name:  "replicas",
+		Usage: "input the json file listing the storage configs of replicas",
+		Value: "",
+	},
+	&cli.IntFlag{
+		Name:  "quorum",
+		Usage: "input how many replicas must be written, default is the majority",
+		Value: 0,
+	},
+}
+
+func storeConfigFromFlags(ctx *cli.Context) (gateway.Config, error) {
+	storageType, err := gateway.ParseStorageType(ctx.String("storage"))
+	if err != nil {
+		return gateway.Config{}, err
+	}
+
+	storeCfg := gateway.Config{
+		Type:  storageType,
+		Api:   ctx.String("ip"),
+		Token: ctx.String("token"),
+		Path:  ctx.String("path"),
+
+		AccessKey: ctx.String("access-key"),
+		SecretKey: ctx.String("secret-key"),
+		Region:    ctx.String("region"),
+
+		Quorum: ctx.Int("quorum"),
+	}
+	if ctx.String("secret-key-file") != "" {
+		secretKey, err := os.ReadFile(ctx.String("secret-key-file"))
+		if err != nil {
+			return storeCfg, err
+		}
+		storeCfg.SecretKey = strings.TrimSpace(string(secretKey))
+	}
+	if storageType == gateway.REPLICA {
+		data, err := os.ReadFile(ctx.String("replicas"))
+		if err != nil {
+			return storeCfg, err
+		}
+		err = json.Unmarshal(data, &storeCfg.Replicas)
+		if err != nil {
+			return storeCfg, err
+		}
+	}
+	return storeCfg, nil
+}
+
+func NewStoreServer(endpoint string) (*http.Server, error) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+
+	router.MaxMultipartMemory = 8 << 20 // 8 MiB
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "Welcome Meeda Store Node")
+	})
+	store.LoadStoreModule(router.Group("/"))
+
+	return &http.Server{
+		Addr:    endpoint,
+		Handler: router,
+	}, nil
+}
@@ -0,0 +1,157 @@
+package light
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/meeda-node/core"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/logs"
+	"github.com/memoio/meeda-node/utils"
+	"gorm.io/gorm"
+)
+
+// the commitments of the alt-DA server protocol of OP-Stack are
+//
+//	0x01 (generic commitment) || da layer byte || kzg commitment (48 bytes)
+const (
+	AltDAGenericCommitment byte = 0x01
+	// the da layer bytes are chosen by the da layers, 0x6d is 'm' of meeda
+	AltDALayerByte byte = 0x6d
+)
+
+// LoadAltDAModule serves the alt-DA server protocol, which is POST /put with
+// the data as the body returning the commitment, and GET /get/0x<commitment>
+// returning the data. op-node sends no credentials, so the requests are not
+// authenticated.
+func LoadAltDAModule(g *gin.RouterGroup) {
+	g.POST("/put", quota.Limit("putObject"), altDAPutHandler)
+	g.GET("/get/:commitment", quota.Limit("getObject"), altDAGetHandler)
+}
+
+// EncodeAltDACommitment wraps the kzg commitment in the generic commitment
+func EncodeAltDACommitment(commitBytes []byte) []byte {
+	return append([]byte{AltDAGenericCommitment, AltDALayerByte}, commitBytes...)
+}
+
+// DecodeAltDACommitment returns the hex encoded kzg commitment, which is the
+// id of the object, of the 0x prefixed hex generic commitment
+func DecodeAltDACommitment(s string) (string, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return "", logs.ServerError{Message: "commitment is not hex encoded"}
+	}
+	if len(b) != 50 || b[0] != AltDAGenericCommitment || b[1] != AltDALayerByte {
+		return "", logs.ServerError{Message: "commitment is not a generic commitment of meeda"}
+	}
+	return hex.EncodeToString(b[2:]), nil
+}
+
+func altDAPutHandler(c *gin.Context) {
+	// the body is the data whatever the content type is
+	c.Request.Header.Set("Content-Type", "application/octet-stream")
+	data, _, err := utils.ReceiveUpload(c.Writer, c.Request, maxLargeDataSize)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	defer data.Close()
+
+	err = core.ChargeQuota(c, data.Size)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	var id string
+	var status int
+	if data.Size > maxDataSize {
+		id, _, status, err = putLargeObject(data, utils.ObjectMeta{}, nil)
+	} else {
+		id, status, err = submitFile(data.Section(0, data.Size), data.Size, data.Elements, utils.ObjectMeta{}, nil)
+	}
+	if pending, ok := err.(addFilePending); ok {
+		// the data is not served until it is added to the contract, so the
+		// batcher has to put it again rather than post the commitment
+		logger.Error(err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, pending.Error())
+		return
+	}
+	if err != nil {
+		logger.Error(err)
+		if status != 0 {
+			c.AbortWithStatusJSON(status, err.Error())
+			return
+		}
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	commitBytes, err := hex.DecodeString(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", EncodeAltDACommitment(commitBytes))
+}
+
+func altDAGetHandler(c *gin.Context) {
+	id, err := DecodeAltDACommitment(c.Param("commitment"))
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	commit, err := decodeCommit(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "commitment is not a legal kzg commitment"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	// op-node tells the missing data by 404
+	_, err = database.GetFileInfoByCommit(commit)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, "commitment is not found")
+		return
+	}
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	data, meta, status, err := getVerifiedObject(id, true)
+	if err != nil {
+		if _, ok := err.(logs.CommitmentMismatch); ok {
+			errRes := logs.ToAPIErrorCode(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		c.AbortWithStatusJSON(status, err.Error())
+		return
+	}
+
+	manifest, err := manifestOf(id, data, meta)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	if manifest != nil {
+		getLargeObject(c, manifest, utils.ObjectMeta{}, true)
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", data)
+}
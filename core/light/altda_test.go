@@ -0,0 +1,51 @@
+package light
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestAltDACommitment(t *testing.T) {
+	commit := bytes.Repeat([]byte{0xab}, 48)
+	id := hex.EncodeToString(commit)
+	encoded := hex.EncodeToString(EncodeAltDACommitment(commit))
+	if !strings.HasPrefix(encoded, "016d") {
+		t.Fatalf("commitment %s is not a generic commitment of meeda", encoded)
+	}
+
+	tests := []struct {
+		name  string
+		s     string
+		fails bool
+	}{
+		{"with 0x", "0x" + encoded, false},
+		{"without 0x", encoded, false},
+		{"short", "0x" + encoded[:len(encoded)-2], true},
+		{"long", "0x" + encoded + "00", true},
+		{"not generic", "0x00" + encoded[2:], true},
+		{"other da layer", "0x0100" + encoded[4:], true},
+		{"kzg commitment only", "0x" + id, true},
+		{"not hex", "0x" + encoded[:len(encoded)-2] + "zz", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeAltDACommitment(tt.s)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("decoded %s", tt.s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("not decoded: %s", err)
+			}
+			if got != id {
+				t.Fatalf("id = %s, want %s", got, id)
+			}
+		})
+	}
+}
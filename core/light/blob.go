@@ -0,0 +1,317 @@
+package light
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/meeda-node/core"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/utils"
+	"golang.org/x/xerrors"
+	"gorm.io/gorm"
+)
+
+// the error codes of json-rpc 2.0
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// errBlobNotFound is the error of celestia-node for missing blobs, which
+// the clients may compare with
+var errBlobNotFound = errors.New("blob: not found")
+
+// how long Submit waits for the blobs to be indexed by the dumper
+var blobIndexTimeout = 2 * time.Minute
+
+// Blob is the blob of the blob api of celestia-node. The namespace is
+// stored as its hex, and the commitment is the kzg commitment of data.
+type Blob struct {
+	Namespace    []byte `json:"namespace"`
+	Data         []byte `json:"data"`
+	ShareVersion uint32 `json:"share_version"`
+	Commitment   []byte `json:"commitment"`
+	Index        int    `json:"index"`
+}
+
+type rpcRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// blobRPCHandler serves blob.Submit, blob.Get and blob.GetAll of the json
+// rpc of celestia-node. The height of a blob is the block in which its
+// AddFile is indexed by the dumper.
+func blobRPCHandler(c *gin.Context) {
+	// the blobs are base64 encoded in json
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 2*maxLargeDataSize+1<<20)
+
+	var req rpcRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+		return
+	}
+	res := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		res.Error = &rpcError{Code: rpcInvalidRequest, Message: "invalid request"}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	var code int
+	switch req.Method {
+	case "blob.Submit":
+		res.Result, code, err = blobSubmit(c, req.Params)
+	case "blob.Get":
+		res.Result, code, err = blobGet(req.Params)
+	case "blob.GetAll":
+		res.Result, code, err = blobGetAll(req.Params)
+	default:
+		code, err = rpcMethodNotFound, xerrors.Errorf("method %s is not found", req.Method)
+	}
+	if err != nil {
+		logger.Error(err)
+		res.Result = nil
+		res.Error = &rpcError{Code: code, Message: err.Error()}
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// blobSubmit puts the blobs and returns the height of the last one
+func blobSubmit(c *gin.Context, params []json.RawMessage) (interface{}, int, error) {
+	var blobs []Blob
+	if len(params) == 0 || json.Unmarshal(params[0], &blobs) != nil || len(blobs) == 0 {
+		return nil, rpcInvalidParams, xerrors.New("params should be [blobs, options]")
+	}
+
+	var height int64
+	for _, blob := range blobs {
+		namespace, err := blobNamespace(blob.Namespace)
+		if err != nil {
+			return nil, rpcInvalidParams, err
+		}
+		if int64(len(blob.Data)) > maxLargeDataSize {
+			return nil, rpcInvalidParams, xerrors.Errorf("blob of %d bytes is larger than %d", len(blob.Data), maxLargeDataSize)
+		}
+		err = core.ChargeQuota(c, int64(len(blob.Data)))
+		if err != nil {
+			return nil, rpcServerError, err
+		}
+
+		// the blob whose AddFile is queued for retry is not indexed soon, so
+		// it is not waited for
+		id, err := submitBlob(blob.Data, namespace)
+		if err != nil {
+			return nil, rpcServerError, err
+		}
+		blockNumber, err := waitBlobIndexed(c.Request.Context(), id)
+		if err != nil {
+			return nil, rpcServerError, err
+		}
+		if blockNumber > height {
+			height = blockNumber
+		}
+	}
+	return height, 0, nil
+}
+
+func submitBlob(blob []byte, namespace string) (string, error) {
+	data, err := utils.Spool(bytes.NewReader(blob))
+	if err != nil {
+		return "", err
+	}
+	defer data.Close()
+
+	meta := utils.ObjectMeta{Namespace: namespace}
+	if data.Size > maxDataSize {
+		id, _, _, err := putLargeObject(data, meta, nil)
+		return id, err
+	}
+	id, _, err := submitFile(data.Section(0, data.Size), data.Size, data.Elements, meta, nil)
+	return id, err
+}
+
+// waitBlobIndexed waits for the dumper to index the AddFile of the blob,
+// and returns the block of it
+func waitBlobIndexed(ctx context.Context, id string) (int64, error) {
+	commit, err := decodeCommit(id)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, blobIndexTimeout)
+	defer cancel()
+	for {
+		file, err := database.GetFileInfoByCommit(commit)
+		if err == nil && file.BlockNumber > 0 {
+			return file.BlockNumber, nil
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, xerrors.Errorf("blob %s is not indexed: %s", id, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// blobGet returns the blob of the commitment in the namespace. The blob is
+// found by its commitment, so the height is not checked.
+func blobGet(params []json.RawMessage) (interface{}, int, error) {
+	var height uint64
+	var ns, commitment []byte
+	if len(params) != 3 || json.Unmarshal(params[0], &height) != nil ||
+		json.Unmarshal(params[1], &ns) != nil || json.Unmarshal(params[2], &commitment) != nil {
+		return nil, rpcInvalidParams, xerrors.New("params should be [height, namespace, commitment]")
+	}
+	namespace, err := blobNamespace(ns)
+	if err != nil {
+		return nil, rpcInvalidParams, err
+	}
+
+	id := hex.EncodeToString(commitment)
+	info, err := getObjectInfoFromStoreNode(baseUrl, id)
+	if err != nil || !info.inNamespace(namespace) {
+		return nil, rpcServerError, errBlobNotFound
+	}
+	blob, err := getBlob(id, namespace)
+	if err != nil {
+		return nil, rpcServerError, err
+	}
+	return blob, 0, nil
+}
+
+// blobGetAll returns the blobs of the namespaces added at the height
+func blobGetAll(params []json.RawMessage) (interface{}, int, error) {
+	var height uint64
+	var nss [][]byte
+	if len(params) != 2 || json.Unmarshal(params[0], &height) != nil || json.Unmarshal(params[1], &nss) != nil {
+		return nil, rpcInvalidParams, xerrors.New("params should be [height, namespaces]")
+	}
+	namespaces := make([]string, 0, len(nss))
+	seen := make(map[string]bool, len(nss))
+	for _, ns := range nss {
+		namespace, err := blobNamespace(ns)
+		if err != nil {
+			return nil, rpcInvalidParams, err
+		}
+		if !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	files, err := database.GetFileInfosByBlock(int64(height))
+	if err != nil {
+		return nil, rpcServerError, err
+	}
+
+	blobs := make([]Blob, 0)
+	for _, file := range files {
+		commitBytes := file.Commit.Bytes()
+		id := hex.EncodeToString(commitBytes[:])
+		// the namespaces are checked before the data is fetched
+		info, err := getObjectInfoFromStoreNode(baseUrl, id)
+		if errors.Is(err, errObjectNotFound) {
+			// the files put by the other light nodes are in other stores
+			continue
+		}
+		if err != nil {
+			return nil, rpcServerError, err
+		}
+		// a blob is returned in every namespace it is put in
+		for _, namespace := range namespaces {
+			if !info.inNamespace(namespace) {
+				continue
+			}
+			blob, err := getBlob(id, namespace)
+			if err != nil {
+				return nil, rpcServerError, err
+			}
+			blobs = append(blobs, blob)
+		}
+	}
+	if len(blobs) == 0 {
+		return nil, rpcServerError, errBlobNotFound
+	}
+	return blobs, 0, nil
+}
+
+// getBlob gets the verified object and reassembles it if it is large. The
+// callers check that the object is put in namespace.
+func getBlob(id string, namespace string) (Blob, error) {
+	commit, err := decodeCommit(id)
+	if err != nil {
+		return Blob{}, errBlobNotFound
+	}
+	_, err = database.GetFileInfoByCommit(commit)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Blob{}, errBlobNotFound
+	}
+	if err != nil {
+		return Blob{}, err
+	}
+
+	data, meta, _, err := getVerifiedObject(id, true)
+	if err != nil {
+		return Blob{}, err
+	}
+	manifest, err := manifestOf(id, data, meta)
+	if err != nil {
+		return Blob{}, err
+	}
+	if manifest != nil {
+		data, _, err = readLargeObject(manifest, true)
+		if err != nil {
+			return Blob{}, err
+		}
+	}
+
+	ns, err := hex.DecodeString(namespace)
+	if err != nil {
+		return Blob{}, errBlobNotFound
+	}
+	commitBytes := commit.Bytes()
+	return Blob{
+		Namespace:  ns,
+		Data:       data,
+		Commitment: commitBytes[:],
+		Index:      -1,
+	}, nil
+}
+
+// blobNamespace is the namespace of the objects of the blobs in ns
+func blobNamespace(ns []byte) (string, error) {
+	namespace := hex.EncodeToString(ns)
+	if !utils.ValidNamespace(namespace) {
+		return "", xerrors.Errorf("namespace of %d bytes is illegal", len(ns))
+	}
+	return namespace, nil
+}
@@ -1,294 +1,932 @@
-package light
-
-import (
-	"bytes"
-	"encoding/hex"
-	"encoding/json"
-	"fmt"
-	"io"
-	"math/big"
-	"net/http"
-	"time"
-
-	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
-	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
-	"github.com/gin-gonic/gin"
-	"github.com/memoio/meeda-node/database"
-	"github.com/memoio/meeda-node/logs"
-	"github.com/memoio/meeda-node/utils"
-	"golang.org/x/xerrors"
-)
-
-func LoadLightModule(g *gin.RouterGroup) {
-	g.GET("/getObject", getObjectHandler)
-	g.POST("/putObject", putObjectHandler)
-	g.GET("/getObjectInfo", getObjectInfoHandler)
-	g.GET("/getProofInfo", getProofInfoHandler)
-	fmt.Println("load light node moudle success!")
-}
-
-func getObjectHandler(c *gin.Context) {
-	id := c.Query("id")
-	if len(id) == 0 {
-		lerr := logs.ServerError{Message: "object's id is not set"}
-		errRes := logs.ToAPIErrorCode(lerr)
-		logger.Error(lerr)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	var data []byte
-	var status int
-	var err error
-	data, _, err = getObjectFromStoreNode(baseUrl, id)
-	if err != nil {
-		logger.Error(err)
-		logger.Info("Get data from the old meeda-store node...")
-		data, status, err = getObjectFromStoreNode(oldStoreNodeUrl, id)
-		if err != nil {
-			logger.Error(err)
-			c.AbortWithStatusJSON(status, err.Error())
-			return
-		}
-	}
-
-	c.Data(http.StatusOK, utils.TypeByExtension(""), data)
-}
-
-func putObjectHandler(c *gin.Context) {
-	body := make(map[string]interface{})
-	c.BindJSON(&body)
-	data, ok := body["data"].(string)
-	if !ok {
-		lerr := logs.ServerError{Message: "field 'data' is not set"}
-		errRes := logs.ToAPIErrorCode(lerr)
-		logger.Error(lerr)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	databyte, err := hex.DecodeString(data)
-	if err != nil {
-		lerr := logs.ServerError{Message: "field 'data' is not legally hexadecimal presented"}
-		errRes := logs.ToAPIErrorCode(lerr)
-		logger.Error(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	elements := utils.SplitData(databyte)
-	commit, err := kzg.Commit(elements, DefaultSRS.Pk)
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(err)
-		logger.Error(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	// check data is uploaded to meeda
-	commitBytes := commit.Bytes()
-	commitHex := hex.EncodeToString(commitBytes[:])
-	_, err = database.GetFileInfoByCommit(commit)
-	if err == nil {
-		logger.Infof("%s is already exist, so we returned", commitHex)
-		c.JSON(http.StatusOK, gin.H{
-			"id": commitHex,
-		})
-		return
-	}
-
-	// check data commitment is uploaded to chain
-	_, expiration, err := proofInstance.GetFileInfo(commit)
-	if err == nil && expiration.Cmp(big.NewInt(0))>0 {
-		logger.Infof("%s is already exist, so we returned", commitHex)
-		c.JSON(http.StatusOK, gin.H{
-			"id": commitHex,
-		})
-		return
-	}
-
-	logger.Infof("begin put object %s to store node", commitHex)
-
-	result, status, err := putObjectIntoStoreNode(baseUrl, databyte, userAddr.String())
-	if err != nil {
-		logger.Error(err)
-		c.AbortWithStatusJSON(status, err.Error())
-		return
-	}
-
-	signature, err := hex.DecodeString(result.Signature)
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(err)
-		logger.Error(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	logger.Infof("begin AddFile %s", commitHex)
-
-	err = proofInstance.AddFile(commit, uint64(result.Size), big.NewInt(result.Start), big.NewInt(result.End), signature)
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(err)
-		logger.Error(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"id": commitHex,
-	})
-}
-
-func getObjectInfoHandler(c *gin.Context) {
-	id := c.Query("id")
-	if len(id) == 0 {
-		lerr := logs.ServerError{Message: "object's id is not set"}
-		errRes := logs.ToAPIErrorCode(lerr)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	commit, err := decodeCommit(id)
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	info, err := database.GetFileInfoByCommit(commit)
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"id":         id,
-		"size":       info.Size,
-		"expiration": info.Expiration,
-	})
-}
-
-func getProofInfoHandler(c *gin.Context) {
-	id := c.Query("id")
-	if len(id) == 0 {
-		lerr := logs.ServerError{Message: "object's id is not set"}
-		errRes := logs.ToAPIErrorCode(lerr)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	commit, err := decodeCommit(id)
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	info, err := database.GetFileInfoByCommit(commit)
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"id":                  id,
-		"chooseNuber":         info.ChooseNumber,
-		"provedSuccessNumber": info.ProvedSuccessNumber,
-	})
-}
-
-func getObjectFromStoreNode(url string, id string) ([]byte, int, error) {
-	client := &http.Client{Timeout: time.Minute}
-	url = url + "/getObject"
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, 500, err
-	}
-
-	params := req.URL.Query()
-	params.Add("id", id)
-	req.URL.RawQuery = params.Encode()
-
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, 500, err
-	}
-	defer res.Body.Close()
-
-	data, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, 500, err
-	}
-
-	if res.StatusCode != http.StatusOK {
-		return nil, res.StatusCode, xerrors.Errorf(string(data))
-	}
-
-	return data, 200, nil
-}
-
-type PutObjectResult struct {
-	Commit    string
-	Size      int64
-	Start     int64
-	End       int64
-	Signature string
-	Mid       string
-}
-
-func putObjectIntoStoreNode(url string, data []byte, from string) (PutObjectResult, int, error) {
-	client := &http.Client{Timeout: 2 * time.Minute}
-	url = url + "/putObject"
-
-	var payload = make(map[string]string)
-	payload["from"] = from
-	payload["data"] = hex.EncodeToString(data)
-
-	b, err := json.Marshal(payload)
-	if err != nil {
-		return PutObjectResult{}, 500, err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
-	if err != nil {
-		return PutObjectResult{}, 500, err
-	}
-
-	req.Header.Add("Content-Type", "application/json")
-	res, err := client.Do(req)
-	if err != nil {
-		return PutObjectResult{}, 500, err
-	}
-	defer res.Body.Close()
-
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return PutObjectResult{}, 500, err
-	}
-
-	if res.StatusCode != http.StatusOK {
-		return PutObjectResult{}, res.StatusCode, xerrors.Errorf(string(body))
-	}
-
-	var result PutObjectResult
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return PutObjectResult{}, 500, err
-	}
-
-	return result, 200, nil
-}
-
-func decodeCommit(id string) (bls12381.G1Affine, error) {
-	var commit bls12381.G1Affine
-	commitBytes, err := hex.DecodeString(id)
-	if err != nil {
-		return commit, err
-	}
-	err = commit.Unmarshal(commitBytes)
-
-	return commit, err
-}
+package light
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/meeda-node/core"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/logs"
+	"github.com/memoio/meeda-node/utils"
+	"golang.org/x/xerrors"
+	"gorm.io/gorm"
+)
+
+func LoadLightModule(g *gin.RouterGroup) {
+	g.GET("/getObject", quota.Limit("getObject"), getObjectHandler)
+	g.POST("/putObject", authenticate, quota.Limit("putObject"), putObjectHandler)
+	g.GET("/getObjectInfo", getObjectInfoHandler)
+	g.GET("/listObjects", listObjectsHandler)
+	// json-rpc of the blob api of celestia-node, whose usage is counted as
+	// putObject
+	g.POST("/rpc", authenticate, quota.Limit("putObject"), blobRPCHandler)
+	g.GET("/getProofInfo", getProofInfoHandler)
+	g.GET("/info", infoHandler)
+	g.GET("/putStatus", authenticate, putStatusHandler)
+	g.GET("/failedAddFiles", authenticate, failedAddFilesHandler)
+	g.GET("/quota", quota.Handler)
+	g.GET("/availability", availabilityHandler)
+	fmt.Println("load light node moudle success!")
+}
+
+// authenticate rejects the requests not accepted by the authenticator, the
+// address of the requester is set as "uploader"
+func authenticate(c *gin.Context) {
+	if authenticator == nil {
+		c.Next()
+		return
+	}
+
+	addr, err := authenticator.Authenticate(c.Request)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	// the body may be staged by the authenticator, which is removed on close
+	defer c.Request.Body.Close()
+
+	// the usage is counted to the address, or to the api key
+	if addr != (common.Address{}) {
+		c.Set("account", addr.Hex())
+	} else if key := utils.APIKeyOf(c.Request); key != "" {
+		c.Set("account", "key:"+hex.EncodeToString(crypto.Keccak256([]byte(key))[:8]))
+	}
+	c.Set("uploader", addr)
+	c.Next()
+}
+
+func getObjectHandler(c *gin.Context) {
+	id := c.Query("id")
+	if len(id) == 0 {
+		lerr := logs.ServerError{Message: "object's id is not set"}
+		errRes := logs.ToAPIErrorCode(lerr)
+		logger.Error(lerr)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	versionedHash, byVersionedHash := utils.ParseVersionedHash(id)
+	id, err := resolveVersionedHash(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	// the deployments trusting the store node may skip the verification
+	verify := !trustStore || c.GetHeader("X-Meeda-Skip-Verify") != "true"
+
+	data, meta, status, err := getVerifiedObject(id, verify)
+	if err == nil && verify && byVersionedHash {
+		err = verifyVersionedHash(versionedHash, id, data, meta.Encoding)
+	}
+	if err != nil {
+		if _, ok := err.(logs.CommitmentMismatch); ok {
+			errRes := logs.ToAPIErrorCode(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		c.AbortWithStatusJSON(status, err.Error())
+		return
+	}
+
+	// the id of a large object refers to its manifest
+	manifest, err := manifestOf(id, data, meta)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	if manifest != nil {
+		getLargeObject(c, manifest, meta, verify)
+		return
+	}
+
+	meta.SetHeaders(c.Writer.Header(), data)
+	c.Data(http.StatusOK, c.Writer.Header().Get("Content-Type"), data)
+}
+
+// getVerifiedObject gets the object from the store node, or from the old
+// one if it fails. If verify is set, the data is checked against the id
+// and the size of the file when it is a commitment, and the store node
+// returning data mismatching them is misbehaving. The metadata of the
+// object is returned with the data, whose encoding is the verified one.
+func getVerifiedObject(id string, verify bool) ([]byte, utils.ObjectMeta, int, error) {
+	urls := []string{baseUrl}
+	if oldStoreNodeUrl != "" {
+		urls = append(urls, oldStoreNodeUrl)
+	}
+
+	size := int64(-1)
+	if commit, err := decodeCommit(id); err == nil && verify {
+		size, err = indexedSize(commit)
+		if err != nil {
+			return nil, utils.ObjectMeta{}, http.StatusNotFound, xerrors.Errorf("file %s is not indexed: %s", id, err)
+		}
+	}
+
+	var status int
+	var err error
+	for i, url := range urls {
+		if i > 0 {
+			logger.Info("Get data from the old meeda-store node...")
+		}
+
+		var data []byte
+		var meta utils.ObjectMeta
+		data, meta, status, err = getObjectWithMeta(url, id)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		if verify {
+			meta.Encoding, err = verifyObject(id, data, size)
+			if err != nil {
+				logger.Errorf("store node %s misbehaves: %s", url, err)
+				status = http.StatusBadGateway
+				continue
+			}
+		}
+		return data, meta, http.StatusOK, nil
+	}
+	return nil, utils.ObjectMeta{}, status, err
+}
+
+// verifyObject checks data of size bytes against id and returns the
+// encoding in which data commits to id. The encoding recorded by this light
+// node is tried first, the one told by the store node is not trusted. The
+// ids which are not commitments can not be checked.
+func verifyObject(id string, data []byte, size int64) (string, error) {
+	commit, err := decodeCommit(id)
+	if err != nil {
+		return "", nil
+	}
+	// the zero padding commits to the same polynomial
+	if int64(len(data)) != size {
+		return "", logs.CommitmentMismatch{ID: id, Message: fmt.Sprintf("got %d bytes, the file has %d", len(data), size)}
+	}
+
+	encodings := []string{utils.EncodingMeeda, utils.EncodingEIP4844}
+	if _, err := database.GetBlobCommitment(commit); err == nil {
+		encodings = []string{utils.EncodingEIP4844, utils.EncodingMeeda}
+	}
+	var got bls12381.G1Affine
+	for _, encoding := range encodings {
+		if encoding == utils.EncodingEIP4844 && size > utils.MaxBlobDataSize {
+			continue
+		}
+		got, err = kzg.Commit(utils.SplitDataAs(encoding, data), DefaultSRS.Pk)
+		if err != nil {
+			return "", logs.CommitmentMismatch{ID: id, Message: err.Error()}
+		}
+		if got.Equal(&commit) {
+			return encoding, nil
+		}
+	}
+	gotBytes := got.Bytes()
+	return "", logs.CommitmentMismatch{ID: id, Message: "got " + hex.EncodeToString(gotBytes[:])}
+}
+
+// indexedSize returns the size of the file of commit added to the contract,
+// or the one in the credential of its AddFile queued by this light node
+func indexedSize(commit bls12381.G1Affine) (int64, error) {
+	file, err := database.GetFileInfoByCommit(commit)
+	if err == nil {
+		return file.Size, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+	intent, ierr := database.GetAddFileIntent(commit)
+	if ierr == nil {
+		return intent.Size, nil
+	}
+	return 0, err
+}
+
+func putObjectHandler(c *gin.Context) {
+	// data larger than one polynomial is split into chunks in large mode
+	large := c.Query("large") == "true"
+	limit := maxDataSize
+	if large {
+		limit = maxLargeDataSize
+	}
+
+	data, fields, err := utils.ReceiveUpload(c.Writer, c.Request, limit)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	defer data.Close()
+
+	meta, err := utils.MetaFromFields(fields)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	err = core.ChargeQuota(c, data.Size)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	// submit the data in background and return the job to query its state
+	if c.Query("async") == "true" {
+		job, err := newPutJob(data, large, meta)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(logs.ServerError{Message: err.Error()})
+			logger.Error(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"job":   job.Job,
+			"state": job.State,
+		})
+		return
+	}
+
+	if large && data.Size > maxDataSize {
+		id, chunks, status, err := putLargeObject(data, meta, nil)
+		if pending, ok := err.(addFilePending); ok {
+			logger.Error(err)
+			c.JSON(http.StatusAccepted, gin.H{
+				"id":      id,
+				"chunks":  chunks,
+				"state":   database.IntentPending,
+				"message": pending.Error(),
+			})
+			return
+		}
+		if err != nil {
+			logger.Error(err)
+			if status != 0 {
+				c.AbortWithStatusJSON(status, err.Error())
+				return
+			}
+			errRes := logs.ToAPIErrorCode(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"id":     id,
+			"chunks": chunks,
+		})
+		return
+	}
+
+	commitHex, status, err := submitFile(data.Section(0, data.Size), data.Size, data.Elements, meta, nil)
+	if pending, ok := err.(addFilePending); ok {
+		// the data is stored, it is added to the contract later
+		logger.Error(err)
+		c.JSON(http.StatusAccepted, gin.H{
+			"id":      commitHex,
+			"state":   database.IntentPending,
+			"message": pending.Error(),
+		})
+		return
+	}
+	if err != nil {
+		logger.Error(err)
+		if status != 0 {
+			c.AbortWithStatusJSON(status, err.Error())
+			return
+		}
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id": commitHex,
+	})
+}
+
+// putProgress is told the state a file reaches and its commitment
+type putProgress func(state, id string)
+
+// submitFile commits the data, puts it into the store node with meta and
+// adds it to the contract. The status is set when the store node fails.
+func submitFile(r io.ReadSeeker, size int64, elements []fr.Element, meta utils.ObjectMeta, progress putProgress) (string, int, error) {
+	if progress == nil {
+		progress = func(string, string) {}
+	}
+
+	// the elements of the other encodings are computed from r, and a blob
+	// of EIP-4844 has the commitment of Ethereum too
+	var blobCommit [48]byte
+	if meta.Encoding == utils.EncodingEIP4844 {
+		if size > utils.MaxBlobDataSize {
+			return "", 0, logs.DataTooLarge{Size: size, Limit: utils.MaxBlobDataSize}
+		}
+		blob, err := io.ReadAll(io.LimitReader(r, size))
+		if err != nil {
+			return "", 0, err
+		}
+		_, err = r.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", 0, err
+		}
+		elements = utils.SplitBlob(blob)
+		blobCommit, err = utils.BlobCommitment(blob)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	commit, err := kzg.Commit(elements, DefaultSRS.Pk)
+	if err != nil {
+		return "", 0, err
+	}
+	if meta.Encoding == utils.EncodingEIP4844 {
+		err = database.SaveBlobCommitment(commit, blobCommit)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	// check data is uploaded to meeda
+	commitBytes := commit.Bytes()
+	commitHex := hex.EncodeToString(commitBytes[:])
+	_, err = database.GetFileInfoByCommit(commit)
+	if err == nil {
+		logger.Infof("%s is already exist, so we returned", commitHex)
+		addNamespace(commitHex, meta.Namespace)
+		progress(database.JobIndexed, commitHex)
+		return commitHex, 0, nil
+	}
+
+	// check data commitment is uploaded to chain
+	_, expiration, err := proofInstance.GetFileInfo(commit)
+	if err == nil && expiration.Cmp(big.NewInt(0))>0 {
+		logger.Infof("%s is already exist, so we returned", commitHex)
+		addNamespace(commitHex, meta.Namespace)
+		progress(database.JobConfirmed, commitHex)
+		return commitHex, 0, nil
+	}
+
+	logger.Infof("begin put object %s to store node", commitHex)
+
+	uploaded := func() {
+		progress(database.JobUploaded, commitHex)
+	}
+	result, status, err := putObjectIntoStoreNode(baseUrl, r, size, userAddr.String(), meta, uploaded)
+	if err != nil {
+		return "", status, err
+	}
+
+	signature, err := hex.DecodeString(result.Signature)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(signature) == 0 {
+		return "", 0, xerrors.New("store node returns no credential")
+	}
+	progress(database.JobCredentialSigned, commitHex)
+
+	// record the intent first, so the AddFile is retried if it fails
+	intent := database.DAAddFileIntent{
+		Commit:    commit,
+		Size:      result.Size,
+		Start:     result.Start,
+		End:       result.End,
+		Signature: signature,
+		NextTry:   time.Now().Add(addFileTxTimeout).Unix(),
+	}
+	err = intent.SaveDAAddFileIntent()
+	saved := err == nil
+	if !saved {
+		logger.Error(err)
+	}
+
+	logger.Infof("begin AddFile %s", commitHex)
+
+	progress(database.JobTxSent, commitHex)
+	err = proofInstance.AddFile(commit, uint64(result.Size), big.NewInt(result.Start), big.NewInt(result.End), signature)
+	if err != nil {
+		if !saved {
+			return "", 0, err
+		}
+		recordAddFileAttempt(intent, err, 1)
+		return commitHex, 0, addFilePending{id: commitHex, err: err}
+	}
+	setAddFileIntentState(intent, database.IntentDone, "")
+	progress(database.JobConfirmed, commitHex)
+
+	return commitHex, 0, nil
+}
+
+func getObjectInfoHandler(c *gin.Context) {
+	id := c.Query("id")
+	if len(id) == 0 {
+		lerr := logs.ServerError{Message: "object's id is not set"}
+		errRes := logs.ToAPIErrorCode(lerr)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	id, err := resolveVersionedHash(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	commit, err := decodeCommit(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	info, err := database.GetFileInfoByCommit(commit)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	// the metadata is kept by the store node
+	meta, err := getObjectInfoFromStoreNode(baseUrl, id)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	// the versioned hash of a blob of EIP-4844 is the one of Ethereum
+	versionedHash := "0x" + hex.EncodeToString(info.VersionedHash[:])
+	var blobCommitment string
+	if blobCommit, err := database.GetBlobCommitment(commit); err == nil {
+		blobVersionedHash := utils.VersionedHash(blobCommit[:])
+		versionedHash = "0x" + hex.EncodeToString(blobVersionedHash[:])
+		blobCommitment = "0x" + hex.EncodeToString(blobCommit[:])
+	} else if meta.BlobCommitment != "" {
+		versionedHash = meta.VersionedHash
+		blobCommitment = meta.BlobCommitment
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":             id,
+		"versionedHash":  versionedHash,
+		"blobCommitment": blobCommitment,
+		"encoding":       meta.Encoding,
+		"manifest":       meta.Manifest,
+		"size":           info.Size,
+		"expiration":     info.Expiration,
+		"contentType":    meta.ContentType,
+		"filename":       meta.Filename,
+		"tags":           meta.Tags,
+		"namespace":      meta.Namespace,
+		"namespaces":     meta.Namespaces,
+	})
+}
+
+// listObjectsHandler lists the objects of a namespace, which are indexed by
+// the store node
+func listObjectsHandler(c *gin.Context) {
+	client := &http.Client{Timeout: time.Minute}
+	req, err := http.NewRequest("GET", baseUrl+"/listObjects", nil)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	req.URL.RawQuery = c.Request.URL.RawQuery
+
+	res, err := client.Do(req)
+	if err != nil {
+		logger.Error(err)
+		c.AbortWithStatusJSON(http.StatusBadGateway, err.Error())
+		return
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		logger.Error(err)
+		c.AbortWithStatusJSON(http.StatusBadGateway, err.Error())
+		return
+	}
+	c.Data(res.StatusCode, res.Header.Get("Content-Type"), body)
+}
+
+func getProofInfoHandler(c *gin.Context) {
+	id := c.Query("id")
+	if len(id) == 0 {
+		lerr := logs.ServerError{Message: "object's id is not set"}
+		errRes := logs.ToAPIErrorCode(lerr)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	commit, err := decodeCommit(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	info, err := database.GetFileInfoByCommit(commit)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":                  id,
+		"chooseNuber":         info.ChooseNumber,
+		"provedSuccessNumber": info.ProvedSuccessNumber,
+	})
+}
+
+func putStatusHandler(c *gin.Context) {
+	id := c.Query("job")
+	if len(id) == 0 {
+		lerr := logs.ServerError{Message: "field 'job' is not set"}
+		errRes := logs.ToAPIErrorCode(lerr)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	job, err := database.GetPutJob(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job":       job.Job,
+		"state":     job.State,
+		"id":        job.Commitment,
+		"size":      job.Size,
+		"large":     job.Large,
+		"chunks":    job.Chunks,
+		"message":   job.Message,
+		"updatedAt": job.UpdatedAt.Unix(),
+	})
+}
+
+// failedAddFilesHandler lists the files put into the store node whose
+// AddFile failed until their credentials expired
+func failedAddFilesHandler(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "offset is not a legal number"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "limit should be between 1 and 1000"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	intents, err := database.GetAddFileIntentsByState(database.IntentFailed, offset, limit)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	files := make([]gin.H, 0, len(intents))
+	for _, intent := range intents {
+		commitBytes := intent.Commit.Bytes()
+		files = append(files, gin.H{
+			"id":       hex.EncodeToString(commitBytes[:]),
+			"size":     intent.Size,
+			"start":    intent.Start,
+			"end":      intent.End,
+			"attempts": intent.Attempts,
+			"message":  intent.Message,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"files": files,
+	})
+}
+
+func infoHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"maxSize":      maxDataSize,
+		"maxLargeSize": maxLargeDataSize,
+		"srsSize":      len(DefaultSRS.Pk.G1),
+		"shardingLen":  utils.ShardingLen,
+	})
+}
+
+// getObjectWithMeta gets the object and the metadata in its headers
+func getObjectWithMeta(url string, id string) ([]byte, utils.ObjectMeta, int, error) {
+	client := &http.Client{Timeout: time.Minute}
+	url = url + "/getObject"
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, utils.ObjectMeta{}, 500, err
+	}
+
+	params := req.URL.Query()
+	params.Add("id", id)
+	req.URL.RawQuery = params.Encode()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, utils.ObjectMeta{}, 500, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, utils.ObjectMeta{}, 500, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, utils.ObjectMeta{}, res.StatusCode, xerrors.Errorf(string(data))
+	}
+
+	return data, utils.MetaFromHeaders(res.Header), 200, nil
+}
+
+// objectInfo is the metadata and the namespaces of an object, which are
+// kept by the store node
+type objectInfo struct {
+	utils.ObjectMeta
+	ID         string   `json:"id"`
+	Namespaces []string `json:"namespaces"`
+	// the commitment of Ethereum and its versioned hash of a blob of
+	// EIP-4844, which are not checked by the light node
+	BlobCommitment string `json:"blobCommitment"`
+	VersionedHash  string `json:"versionedHash"`
+}
+
+// inNamespace reports whether the object is put in namespace
+func (o objectInfo) inNamespace(namespace string) bool {
+	if o.Namespace == namespace {
+		return true
+	}
+	for _, ns := range o.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// errObjectNotFound is returned if the store node does not keep the object
+var errObjectNotFound = errors.New("object is not found in the store node")
+
+func getObjectInfoFromStoreNode(url string, id string) (objectInfo, error) {
+	client := &http.Client{Timeout: time.Minute}
+	req, err := http.NewRequest("GET", url+"/getObjectInfo", nil)
+	if err != nil {
+		return objectInfo{}, err
+	}
+
+	params := req.URL.Query()
+	params.Add("id", id)
+	req.URL.RawQuery = params.Encode()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return objectInfo{}, errObjectNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return objectInfo{}, xerrors.Errorf(string(body))
+	}
+
+	var info objectInfo
+	err = json.Unmarshal(body, &info)
+	return info, err
+}
+
+// addNamespace lists the data already put in the namespace as well, the
+// failure is only logged since the data is put anyway
+func addNamespace(id, namespace string) {
+	if namespace == "" {
+		return
+	}
+	err := addNamespaceToStoreNode(baseUrl, id, namespace)
+	if err != nil {
+		logger.Errorf("add %s to namespace %s: %s", id, namespace, err)
+	}
+}
+
+func addNamespaceToStoreNode(url, id, namespace string) error {
+	client := &http.Client{Timeout: time.Minute}
+	req, err := http.NewRequest("POST", url+"/addNamespace", nil)
+	if err != nil {
+		return err
+	}
+
+	params := req.URL.Query()
+	params.Add("id", id)
+	params.Add("namespace", namespace)
+	req.URL.RawQuery = params.Encode()
+
+	err = utils.SignRequest(req, crypto.Keccak256(nil), userSk)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return xerrors.Errorf(string(body))
+	}
+	return nil
+}
+
+type PutObjectResult struct {
+	Commit    string
+	Size      int64
+	Start     int64
+	End       int64
+	Signature string
+	Mid       string
+}
+
+// putObjectIntoStoreNode sends size bytes of data to the store node as
+// application/octet-stream with meta in the query, the request is signed by
+// the light node which is the from of the credential. uploaded is called
+// once all the data is sent, before the credential is returned.
+func putObjectIntoStoreNode(url string, data io.ReadSeeker, size int64, from string, meta utils.ObjectMeta, uploaded func()) (PutObjectResult, int, error) {
+	client := &http.Client{Timeout: 2 * time.Minute}
+	url = url + "/putObject"
+
+	hasher := crypto.NewKeccakState()
+	_, err := io.Copy(hasher, io.LimitReader(data, size))
+	if err != nil {
+		return PutObjectResult{}, 500, err
+	}
+	_, err = data.Seek(0, io.SeekStart)
+	if err != nil {
+		return PutObjectResult{}, 500, err
+	}
+
+	upload := &uploadReader{r: io.LimitReader(data, size), left: size, uploaded: uploaded}
+	req, err := http.NewRequest("POST", url, upload)
+	if err != nil {
+		return PutObjectResult{}, 500, err
+	}
+	req.ContentLength = size
+
+	params := req.URL.Query()
+	params.Add("from", from)
+	for k, v := range meta.Fields() {
+		params.Add(k, v)
+	}
+	req.URL.RawQuery = params.Encode()
+
+	req.Header.Add("Content-Type", "application/octet-stream")
+	err = utils.SignRequest(req, hasher.Sum(nil), userSk)
+	if err != nil {
+		return PutObjectResult{}, 500, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return PutObjectResult{}, 500, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return PutObjectResult{}, 500, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return PutObjectResult{}, res.StatusCode, xerrors.Errorf(string(body))
+	}
+
+	var result PutObjectResult
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return PutObjectResult{}, 500, err
+	}
+
+	return result, 200, nil
+}
+
+// uploadReader calls uploaded once left bytes are read
+type uploadReader struct {
+	r        io.Reader
+	left     int64
+	uploaded func()
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.left -= int64(n)
+	if u.left <= 0 && u.uploaded != nil {
+		u.uploaded()
+		u.uploaded = nil
+	}
+	return n, err
+}
+
+// resolveVersionedHash returns the hex of the commitment whose versioned
+// hash is id, or id itself if it is not a versioned hash. The versioned
+// hashes of the blobs of EIP-4844 are the ones of Ethereum, and the ones of
+// the blobs put through other light nodes are resolved by the store node,
+// which is checked by verifyVersionedHash.
+func resolveVersionedHash(id string) (string, error) {
+	versionedHash, ok := utils.ParseVersionedHash(id)
+	if !ok {
+		return id, nil
+	}
+	commit, err := database.GetCommitByBlobVersionedHash(versionedHash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var file database.DAFileInfo
+		file, err = database.GetFileInfoByVersionedHash(versionedHash)
+		commit = file.Commit
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		info, serr := getObjectInfoFromStoreNode(baseUrl, id)
+		if serr != nil {
+			return id, err
+		}
+		return info.ID, nil
+	}
+	if err != nil {
+		return id, err
+	}
+	commitBytes := commit.Bytes()
+	return hex.EncodeToString(commitBytes[:]), nil
+}
+
+// verifyVersionedHash checks that the object of id, whose data is checked
+// against id, has the versioned hash
+func verifyVersionedHash(versionedHash [32]byte, id string, data []byte, encoding string) error {
+	commit, err := decodeCommit(id)
+	if err != nil {
+		return logs.CommitmentMismatch{ID: id, Message: err.Error()}
+	}
+	commitBytes := commit.Bytes()
+	if utils.VersionedHash(commitBytes[:]) == versionedHash {
+		return nil
+	}
+	if encoding != utils.EncodingEIP4844 {
+		return logs.CommitmentMismatch{ID: id, Message: "versioned hash mismatches"}
+	}
+
+	blobCommit, err := utils.BlobCommitment(data)
+	if err != nil {
+		return logs.CommitmentMismatch{ID: id, Message: err.Error()}
+	}
+	if utils.VersionedHash(blobCommit[:]) != versionedHash {
+		return logs.CommitmentMismatch{ID: id, Message: "versioned hash mismatches"}
+	}
+	// the blob is resolved by the light node from now on
+	err = database.SaveBlobCommitment(commit, blobCommit)
+	if err != nil {
+		logger.Error(err)
+	}
+	return nil
+}
+
+func decodeCommit(id string) (bls12381.G1Affine, error) {
+	var commit bls12381.G1Affine
+	commitBytes, err := hex.DecodeString(id)
+	if err != nil {
+		return commit, err
+	}
+	err = commit.Unmarshal(commitBytes)
+
+	return commit, err
+}
@@ -1,56 +1,95 @@
-package light
-
-import (
-	"crypto/ecdsa"
-
-	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
-	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
-	dkzg "github.com/memoio/did-solidity/kzg"
-	proof "github.com/memoio/go-did/file-proof"
-	"github.com/memoio/meeda-node/logs"
-)
-
-var baseUrl string
-var oldStoreNodeUrl string
-var logger = logs.Logger("light node")
-var zeroCommit bls12381.G1Affine
-var zeroProof kzg.OpeningProof
-var userSk *ecdsa.PrivateKey
-var userAddr common.Address
-var proofInstance *proof.ProofInstance
-var DefaultSRS *kzg.SRS
-
-func InitLightNode(chain string, sk *ecdsa.PrivateKey, ip, oldip string, addrs *proof.ContractAddress) error {
-	userSk = sk
-	userAddr = crypto.PubkeyToAddress(userSk.PublicKey)
-
-	zeroCommit.X.SetZero()
-	zeroCommit.Y.SetZero()
-
-	zeroProof.ClaimedValue.SetZero()
-	zeroProof.H.X.SetZero()
-	zeroProof.H.Y.SetZero()
-
-	var err error
-	proofInstance, err = proof.NewProofInstance(userSk, chain, addrs)
-	if err != nil {
-		return err
-	}
-
-	key, err := dkzg.InitKey()
-	if err != nil {
-		return err
-	}
-
-	DefaultSRS = &kzg.SRS{
-		Pk: key.Pk,
-		Vk: key.Vk,
-	}
-
-	baseUrl = ip
-	oldStoreNodeUrl = oldip
-
-	return nil
-}
+package light
+
+import (
+	"crypto/ecdsa"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	dkzg "github.com/memoio/did-solidity/kzg"
+	proof "github.com/memoio/go-did/file-proof"
+	"github.com/memoio/meeda-node/core"
+	"github.com/memoio/meeda-node/logs"
+	"github.com/memoio/meeda-node/utils"
+)
+
+var baseUrl string
+var oldStoreNodeUrl string
+var logger = logs.Logger("light node")
+var zeroCommit bls12381.G1Affine
+var zeroProof kzg.OpeningProof
+var userSk *ecdsa.PrivateKey
+var userAddr common.Address
+var proofInstance *proof.ProofInstance
+var DefaultSRS *kzg.SRS
+var maxDataSize int64
+var maxLargeDataSize int64 = 64 << 20
+var authenticator utils.Authenticator
+var trustStore bool
+var quota *core.Quota
+
+func InitLightNode(chain string, sk *ecdsa.PrivateKey, ip, oldip string, addrs *proof.ContractAddress) error {
+	userSk = sk
+	userAddr = crypto.PubkeyToAddress(userSk.PublicKey)
+
+	zeroCommit.X.SetZero()
+	zeroCommit.Y.SetZero()
+
+	zeroProof.ClaimedValue.SetZero()
+	zeroProof.H.X.SetZero()
+	zeroProof.H.Y.SetZero()
+
+	var err error
+	proofInstance, err = proof.NewProofInstance(userSk, chain, addrs)
+	if err != nil {
+		return err
+	}
+
+	key, err := dkzg.InitKey()
+	if err != nil {
+		return err
+	}
+
+	DefaultSRS = &kzg.SRS{
+		Pk: key.Pk,
+		Vk: key.Vk,
+	}
+
+	SetMaxDataSize(0, 0)
+
+	baseUrl = ip
+	oldStoreNodeUrl = oldip
+
+	return nil
+}
+
+// SetMaxDataSize limits the size of data put, the size that the SRS can
+// commit is used if size is not positive or larger than it. Data up to
+// largeSize is accepted in large mode.
+func SetMaxDataSize(size, largeSize int64) {
+	maxDataSize = utils.MaxDataSize(len(DefaultSRS.Pk.G1))
+	if size > 0 && size < maxDataSize {
+		maxDataSize = size
+	}
+	if largeSize > 0 {
+		maxLargeDataSize = largeSize
+	}
+}
+
+// SetAuthenticator guards the routes which cost the light node, they are
+// open to everyone if auth is nil
+func SetAuthenticator(auth utils.Authenticator) {
+	authenticator = auth
+}
+
+// SetTrustStore lets the clients skip the verification of data by the
+// header X-Meeda-Skip-Verify, for the deployments trusting the store node
+func SetTrustStore(trust bool) {
+	trustStore = trust
+}
+
+// SetQuota limits the usage of every account, there is no limit if q is nil
+func SetQuota(q *core.Quota) {
+	quota = q
+}
@@ -0,0 +1,268 @@
+package light
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/utils"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+// how many put jobs wait for the running one
+const maxQueuedJobs = 256
+
+var errJobQueueFull = xerrors.New("too many put jobs are queued")
+
+var jobDir string
+var jobQueue = make(chan database.DAPutJob, maxQueuedJobs)
+var jobIndexInterval = 30 * time.Second
+
+// StartPutJobs runs the async put jobs one by one, the data of the jobs is
+// kept in dir until they are confirmed. The jobs unfinished by last run
+// are resumed.
+func StartPutJobs(ctx context.Context, dir string) error {
+	var err error
+	jobDir, err = homedir.Expand(dir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(jobDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := database.GetPutJobsByStates(database.JobReceived, database.JobUploaded, database.JobCredentialSigned, database.JobTxSent)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		// resume the jobs in order, the new ones queue behind them
+		for _, job := range jobs {
+			if job.State == database.JobTxSent && hasAddFileIntent(job) {
+				// left to watchIndexedJobs, the AddFile is retried
+				continue
+			}
+			logger.Infof("resume put job %s from %s", job.Job, job.State)
+			runPutJob(job)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case job := <-jobQueue:
+				runPutJob(job)
+			}
+		}
+	}()
+	go watchIndexedJobs(ctx)
+
+	return nil
+}
+
+// newPutJob keeps data and queues a job to submit it with meta
+func newPutJob(data *utils.SpooledData, large bool, meta utils.ObjectMeta) (database.DAPutJob, error) {
+	if len(jobQueue) == cap(jobQueue) {
+		return database.DAPutJob{}, errJobQueueFull
+	}
+
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return database.DAPutJob{}, err
+	}
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return database.DAPutJob{}, err
+	}
+
+	job := database.DAPutJob{
+		Job:   hex.EncodeToString(id),
+		State: database.JobReceived,
+		Size:  data.Size,
+		Large: large,
+		Path:  filepath.Join(jobDir, hex.EncodeToString(id)),
+		Meta:  string(metaBytes),
+	}
+	err = data.Keep(job.Path)
+	if err != nil {
+		return job, err
+	}
+	err = job.CreateDAPutJob()
+	if err != nil {
+		os.Remove(job.Path)
+		return job, err
+	}
+
+	select {
+	case jobQueue <- job:
+	default:
+		// the queue is filled by the concurrent requests meanwhile
+		failPutJob(job, errJobQueueFull)
+		os.Remove(job.Path)
+		return job, errJobQueueFull
+	}
+	return job, nil
+}
+
+func runPutJob(job database.DAPutJob) {
+	data, err := utils.LoadSpooled(job.Path)
+	if err != nil {
+		failPutJob(job, err)
+		return
+	}
+	// the data is removed once the job is finished
+	defer data.Close()
+
+	var meta utils.ObjectMeta
+	if job.Meta != "" {
+		err = json.Unmarshal([]byte(job.Meta), &meta)
+		if err != nil {
+			failPutJob(job, err)
+			return
+		}
+	}
+
+	// in large mode, every chunk and then the manifest go through the states
+	progress := func(state, id string) {
+		if state == database.JobConfirmed || state == database.JobIndexed {
+			job.Chunks++
+		}
+		job.State = state
+		job.Commitment = id
+		err := job.UpdateDAPutJob()
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+
+	var id string
+	if job.Large && data.Size > maxDataSize {
+		var chunks []string
+		id, chunks, _, err = putLargeObject(data, meta, progress)
+		job.Chunks = len(chunks)
+	} else {
+		id, _, err = submitFile(data.Section(0, data.Size), data.Size, data.Elements, meta, progress)
+		job.Chunks = 0
+	}
+	if _, ok := err.(addFilePending); ok {
+		// the job is confirmed by watchIndexedJobs once the AddFile is retried
+		logger.Errorf("put job %s: %s", job.Job, err)
+		job.Commitment = id
+		job.State = database.JobTxSent
+		job.Message = err.Error()
+		err = job.UpdateDAPutJob()
+		if err != nil {
+			logger.Error(err)
+		}
+		return
+	}
+	if err != nil {
+		failPutJob(job, err)
+		return
+	}
+
+	job.Commitment = id
+	if job.State != database.JobIndexed {
+		job.State = database.JobConfirmed
+	}
+	err = job.UpdateDAPutJob()
+	if err != nil {
+		logger.Error(err)
+	}
+	logger.Infof("put job %s is %s", job.Job, job.State)
+}
+
+func failPutJob(job database.DAPutJob, err error) {
+	logger.Errorf("put job %s failed: %s", job.Job, err)
+	job.State = database.JobFailed
+	job.Message = err.Error()
+	uerr := job.UpdateDAPutJob()
+	if uerr != nil {
+		logger.Error(uerr)
+	}
+}
+
+func hasAddFileIntent(job database.DAPutJob) bool {
+	commit, err := decodeCommit(job.Commitment)
+	if err != nil {
+		return false
+	}
+	_, err = database.GetAddFileIntent(commit)
+	return err == nil
+}
+
+// watchIndexedJobs marks the confirmed jobs indexed once the dumper has
+// seen their files on chain, and settles the jobs whose AddFile is retried
+func watchIndexedJobs(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jobIndexInterval):
+		}
+
+		settleRetriedJobs()
+
+		jobs, err := database.GetPutJobsByStates(database.JobConfirmed)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		for _, job := range jobs {
+			commit, err := decodeCommit(job.Commitment)
+			if err != nil {
+				continue
+			}
+			_, err = database.GetFileInfoByCommit(commit)
+			if err != nil {
+				continue
+			}
+			job.State = database.JobIndexed
+			err = job.UpdateDAPutJob()
+			if err != nil {
+				logger.Error(err)
+			}
+		}
+	}
+}
+
+// settleRetriedJobs follows the AddFile intents of the jobs left in tx-sent
+func settleRetriedJobs() {
+	jobs, err := database.GetPutJobsByStates(database.JobTxSent)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	for _, job := range jobs {
+		commit, err := decodeCommit(job.Commitment)
+		if err != nil {
+			continue
+		}
+		intent, err := database.GetAddFileIntent(commit)
+		if err != nil {
+			continue
+		}
+		switch intent.State {
+		case database.IntentDone:
+			job.State = database.JobConfirmed
+			job.Message = ""
+		case database.IntentFailed:
+			job.State = database.JobFailed
+			job.Message = intent.Message
+		default:
+			continue
+		}
+		err = job.UpdateDAPutJob()
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package light
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/logs"
+	"github.com/memoio/meeda-node/utils"
+	"golang.org/x/xerrors"
+)
+
+// manifestMagic marks the blobs which are manifests of large objects
+const manifestMagic = "meeda-manifest/v1\n"
+
+// Manifest ties the chunks of a large object together. Every chunk is an
+// ordinary file committed and added to the contract, and the manifest is
+// stored as a file as well, whose commitment is the id of the object. The
+// manifests are flagged by the store node, and the ones put through this
+// light node are recorded in the DAManifestStore table too. The content of
+// the other files is never taken as a manifest.
+type Manifest struct {
+	Size      int64    `json:"size"`
+	ChunkSize int64    `json:"chunkSize"`
+	Chunks    []string `json:"chunks"`
+}
+
+func (m *Manifest) encode() ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(manifestMagic), data...), nil
+}
+
+func parseManifest(data []byte) (*Manifest, bool) {
+	if !bytes.HasPrefix(data, []byte(manifestMagic)) {
+		return nil, false
+	}
+
+	var m Manifest
+	err := json.Unmarshal(data[len(manifestMagic):], &m)
+	if err != nil || m.Size <= 0 || m.ChunkSize <= 0 {
+		return nil, false
+	}
+	if int64(len(m.Chunks)) != (m.Size-1)/m.ChunkSize+1 {
+		return nil, false
+	}
+	for _, chunk := range m.Chunks {
+		if _, err := hex.DecodeString(chunk); err != nil || len(chunk) != 96 {
+			return nil, false
+		}
+	}
+	return &m, true
+}
+
+// manifestOf returns the manifest in data if the file id is recorded as a
+// manifest or meta from the store node flags it, or nil if it is not
+func manifestOf(id string, data []byte, meta utils.ObjectMeta) (*Manifest, error) {
+	commit, err := decodeCommit(id)
+	if err != nil {
+		// the object got by mid is not a manifest
+		return nil, nil
+	}
+	ok := meta.Manifest
+	if !ok {
+		ok, err = database.IsManifest(commit)
+		if err != nil {
+			return nil, logs.DataBaseError{Message: err.Error()}
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	m, ok := parseManifest(data)
+	if !ok {
+		return nil, xerrors.Errorf("manifest %s is broken", id)
+	}
+	return m, nil
+}
+
+// putLargeObject splits data into chunks of one polynomial each and submits
+// them and their manifest, which carries the metadata of the object
+func putLargeObject(data *utils.SpooledData, meta utils.ObjectMeta, progress putProgress) (string, []string, int, error) {
+	// chunks are cut at the boundary of 127 bytes, so the elements of each
+	// chunk are a section of the elements of data
+	if meta.Encoding != utils.EncodingMeeda {
+		return "", nil, 0, logs.ServerError{Message: "large objects are not supported in encoding " + meta.Encoding}
+	}
+	chunkSize := maxDataSize / utils.ShardingLen * utils.ShardingLen
+	if chunkSize == 0 {
+		return "", nil, 0, logs.ConfigError{Message: "max data size is less than " + strconv.Itoa(utils.ShardingLen)}
+	}
+
+	manifest := Manifest{
+		Size:      data.Size,
+		ChunkSize: chunkSize,
+	}
+	// set when the AddFile of some chunk is queued for retry
+	var pendingErr error
+	for off := int64(0); off < data.Size; off += chunkSize {
+		n := data.Size - off
+		if n > chunkSize {
+			n = chunkSize
+		}
+		first := off / utils.ShardingLen * 4
+		last := first + ((n-1)/utils.ShardingLen+1)*4
+
+		logger.Infof("begin put chunk %d of large object", len(manifest.Chunks))
+		id, status, err := submitFile(data.Section(off, n), n, data.Elements[first:last], utils.ObjectMeta{}, progress)
+		if pending, ok := err.(addFilePending); ok {
+			// the chunk is stored, go on with the others
+			logger.Error(err)
+			pendingErr = pending
+		} else if err != nil {
+			return "", nil, status, err
+		}
+		manifest.Chunks = append(manifest.Chunks, id)
+	}
+
+	mdata, err := manifest.encode()
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if int64(len(mdata)) > maxDataSize {
+		// the manifest itself has to fit in one polynomial
+		return "", nil, 0, logs.DataTooLarge{Size: int64(len(mdata)), Limit: maxDataSize}
+	}
+
+	var splitter utils.Splitter
+	splitter.Write(mdata)
+	meta.Manifest = true
+	id, status, err := submitFile(bytes.NewReader(mdata), int64(len(mdata)), splitter.Elements(), meta, progress)
+	if _, ok := err.(addFilePending); ok {
+		pendingErr = err
+	} else if err != nil {
+		return "", nil, status, err
+	}
+
+	commit, err := decodeCommit(id)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	err = database.SaveManifest(commit)
+	if err != nil {
+		return "", nil, 0, logs.DataBaseError{Message: err.Error()}
+	}
+
+	return id, manifest.Chunks, 0, pendingErr
+}
+
+// getLargeObject reassembles the object of manifest from its chunks, which
+// are verified against their commitments if verify is set. All the chunks
+// are read before the response is started.
+func getLargeObject(c *gin.Context, manifest *Manifest, meta utils.ObjectMeta, verify bool) {
+	data, status, err := readLargeObject(manifest, verify)
+	if err != nil {
+		logger.Error(err)
+		if _, ok := err.(logs.CommitmentMismatch); ok {
+			errRes := logs.ToAPIErrorCode(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		c.AbortWithStatusJSON(status, err.Error())
+		return
+	}
+
+	// the object itself is not a manifest
+	meta.Manifest = false
+	meta.SetHeaders(c.Writer.Header(), data)
+	c.Data(http.StatusOK, c.Writer.Header().Get("Content-Type"), data)
+}
+
+// readLargeObject reassembles the object of manifest in memory, the status
+// is the one of the failed chunk
+func readLargeObject(manifest *Manifest, verify bool) ([]byte, int, error) {
+	data := make([]byte, 0, manifest.Size)
+	for i, chunk := range manifest.Chunks {
+		chunkData, _, status, err := getVerifiedObject(chunk, verify)
+		if err != nil {
+			return nil, status, err
+		}
+		expected := manifest.ChunkSize
+		if i == len(manifest.Chunks)-1 {
+			expected = manifest.Size - int64(i)*manifest.ChunkSize
+		}
+		if int64(len(chunkData)) != expected {
+			return nil, http.StatusInternalServerError, xerrors.Errorf("got %d bytes of chunk %s, expected %d", len(chunkData), chunk, expected)
+		}
+		data = append(data, chunkData...)
+	}
+	return data, 0, nil
+}
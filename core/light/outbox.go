@@ -0,0 +1,112 @@
+package light
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"time"
+
+	"github.com/memoio/meeda-node/database"
+)
+
+var addFileRetryInterval = 30 * time.Second
+var addFileMaxBackoff = time.Hour
+
+// how long the first AddFile of a file is waited for before it is retried,
+// so the retries do not send it again while it is in flight
+var addFileTxTimeout = 5 * time.Minute
+
+// addFilePending is returned when the file is put into the store node but
+// AddFile failed, the AddFile is retried in background
+type addFilePending struct {
+	id  string
+	err error
+}
+
+func (e addFilePending) Error() string {
+	return "AddFile of " + e.id + " is queued for retry: " + e.err.Error()
+}
+
+func (e addFilePending) Unwrap() error {
+	return e.err
+}
+
+// addFileBackoff is the delay after the attempts failed, doubling from the
+// retry interval up to an hour
+func addFileBackoff(attempts int) time.Duration {
+	backoff := addFileRetryInterval
+	for i := 1; i < attempts && backoff < addFileMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > addFileMaxBackoff {
+		backoff = addFileMaxBackoff
+	}
+	return backoff
+}
+
+// RetryAddFiles retries the pending AddFile intents until they succeed or
+// their credentials expire
+func RetryAddFiles(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(addFileRetryInterval):
+		}
+
+		intents, err := database.GetDueAddFileIntents(time.Now().Unix(), 100)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		for _, intent := range intents {
+			if ctx.Err() != nil {
+				return
+			}
+			retryAddFile(intent)
+		}
+	}
+}
+
+func retryAddFile(intent database.DAAddFileIntent) {
+	commitBytes := intent.Commit.Bytes()
+	commitHex := hex.EncodeToString(commitBytes[:])
+
+	// the file may be added by the last attempt whose result was lost
+	_, expiration, err := proofInstance.GetFileInfo(intent.Commit)
+	if err == nil && expiration.Cmp(big.NewInt(0)) > 0 {
+		logger.Infof("AddFile %s is confirmed", commitHex)
+		setAddFileIntentState(intent, database.IntentDone, "")
+		return
+	}
+
+	if time.Now().Unix() > intent.End {
+		logger.Errorf("AddFile %s failed permanently, the credential expired after %d attempts", commitHex, intent.Attempts)
+		setAddFileIntentState(intent, database.IntentFailed, "credential expired: "+intent.Message)
+		return
+	}
+
+	logger.Infof("retry AddFile %s", commitHex)
+	err = proofInstance.AddFile(intent.Commit, uint64(intent.Size), big.NewInt(intent.Start), big.NewInt(intent.End), intent.Signature)
+	if err != nil {
+		logger.Error(err)
+		recordAddFileAttempt(intent, err, intent.Attempts+1)
+		return
+	}
+	setAddFileIntentState(intent, database.IntentDone, "")
+}
+
+func recordAddFileAttempt(intent database.DAAddFileIntent, err error, attempts int) {
+	nextTry := time.Now().Add(addFileBackoff(attempts)).Unix()
+	uerr := database.RecordAddFileAttempt(intent.Commit, err.Error(), nextTry)
+	if uerr != nil {
+		logger.Error(uerr)
+	}
+}
+
+func setAddFileIntentState(intent database.DAAddFileIntent, state, message string) {
+	err := database.SetAddFileIntentState(intent.Commit, state, message)
+	if err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,211 @@
+package light
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/logs"
+	"golang.org/x/xerrors"
+)
+
+// SamplerStats accumulates the samples since the node started
+type SamplerStats struct {
+	LastRun      int64 `json:"lastRun"`
+	Samples      int64 `json:"samples"`
+	Failures     int64 `json:"failures"`
+	LastSamples  int64 `json:"lastSamples"`
+	LastFailures int64 `json:"lastFailures"`
+}
+
+var samplerLk sync.Mutex
+var samplerStats SamplerStats
+
+// SampleDataAvailability samples n random active files from the store node
+// every interval, the files are the ones stored by this light node since
+// the other ones may be kept by other store nodes. Each sample asks for the opening proof at a random point
+// and checks it against the commitment, the store node failing samples is
+// alerted in the log.
+func SampleDataAvailability(ctx context.Context, interval time.Duration, n int) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		files, err := database.GetRandomActiveFileInfos(time.Now().Unix(), n)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+
+		var failures int64
+		for _, file := range files {
+			err := sampleFile(baseUrl, file.Commit)
+			commitBytes := file.Commit.Bytes()
+			commitHex := hex.EncodeToString(commitBytes[:])
+			message := ""
+			if err != nil {
+				failures++
+				message = err.Error()
+				logger.Warnf("sample %s failed: %s", commitHex, message)
+			}
+			err = database.RecordSample(file.Commit, err == nil, message, time.Now().Unix())
+			if err != nil {
+				logger.Error(err)
+			}
+		}
+		if failures > 0 {
+			logger.Errorf("ALERT: store node %s failed %d of %d samples", baseUrl, failures, len(files))
+		}
+
+		samplerLk.Lock()
+		samplerStats.LastRun = time.Now().Unix()
+		samplerStats.Samples += int64(len(files))
+		samplerStats.Failures += failures
+		samplerStats.LastSamples = int64(len(files))
+		samplerStats.LastFailures = failures
+		samplerLk.Unlock()
+	}
+}
+
+// sampleFile verifies the opening proof of the file at a random point
+func sampleFile(url string, commit bls12381.G1Affine) error {
+	var point fr.Element
+	_, err := point.SetRandom()
+	if err != nil {
+		return err
+	}
+
+	commitBytes := commit.Bytes()
+	pointBytes := point.Bytes()
+	proof, err := getOpeningProofFromStoreNode(url, hex.EncodeToString(commitBytes[:]), "0x"+hex.EncodeToString(pointBytes[:]))
+	if err != nil {
+		return err
+	}
+
+	return kzg.Verify(&commit, &proof, point, DefaultSRS.Vk)
+}
+
+func getOpeningProofFromStoreNode(url string, id string, point string) (kzg.OpeningProof, error) {
+	client := &http.Client{Timeout: time.Minute}
+	req, err := http.NewRequest("GET", url+"/getOpeningProof", nil)
+	if err != nil {
+		return kzg.OpeningProof{}, err
+	}
+
+	params := req.URL.Query()
+	params.Add("id", id)
+	params.Add("point", point)
+	req.URL.RawQuery = params.Encode()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return kzg.OpeningProof{}, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return kzg.OpeningProof{}, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return kzg.OpeningProof{}, xerrors.Errorf(string(body))
+	}
+
+	var result struct {
+		Value string
+		H     string
+	}
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return kzg.OpeningProof{}, err
+	}
+
+	var proof kzg.OpeningProof
+	valueBytes, err := hex.DecodeString(result.Value)
+	if err != nil || len(valueBytes) != fr.Bytes {
+		return proof, xerrors.Errorf("claimed value %q is not a legal field element", result.Value)
+	}
+	proof.ClaimedValue.SetBytes(valueBytes)
+	hBytes, err := hex.DecodeString(result.H)
+	if err != nil {
+		return proof, err
+	}
+	_, err = proof.H.SetBytes(hBytes)
+	if err != nil {
+		return proof, err
+	}
+	return proof, nil
+}
+
+// availabilityHandler returns the availability score of the file, or the
+// stats of the sampler and the files failing samples if id is not set
+func availabilityHandler(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "limit should be between 1 and 1000"})
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		samples, err := database.ListFailingSamples(0, limit)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		failing := make([]gin.H, 0, len(samples))
+		for _, sample := range samples {
+			failing = append(failing, sampleToJSON(sample))
+		}
+		samplerLk.Lock()
+		stats := samplerStats
+		samplerLk.Unlock()
+		c.JSON(http.StatusOK, gin.H{
+			"stats":   stats,
+			"failing": failing,
+		})
+		return
+	}
+
+	commit, err := decodeCommit(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	sample, err := database.GetSampleInfo(commit)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, sampleToJSON(sample))
+}
+
+func sampleToJSON(sample database.DASampleInfo) gin.H {
+	commitBytes := sample.Commit.Bytes()
+	return gin.H{
+		"id":                  hex.EncodeToString(commitBytes[:]),
+		"score":               sample.Score(),
+		"samples":             sample.Samples,
+		"failures":            sample.Failures,
+		"consecutiveFailures": sample.ConsecutiveFailures,
+		"lastSampled":         sample.LastSampled,
+		"lastError":           sample.LastError,
+	}
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/logs"
+)
+
+// the usage is counted in buckets of a minute, so the window slides by
+// minutes
+const quotaBucket = 60
+
+// QuotaLimit limits the requests and bytes of an account on a route in the
+// window, zero means no limit
+type QuotaLimit struct {
+	Requests int64
+	Bytes    int64
+}
+
+// Quota tracks the requests and bytes of every account on the routes, and
+// limits them over the sliding window. The account of a request is set as
+// "account" by the authentication, or it is the client ip.
+type Quota struct {
+	Window time.Duration
+	Limits map[string]QuotaLimit
+
+	// the usage is checked and counted by one request at a time, as the
+	// transactions of sqlite do not lock what they read
+	lk sync.Mutex
+}
+
+type quotaState struct {
+	quota   *Quota
+	account string
+	route   string
+	limit   QuotaLimit
+	charged int64
+}
+
+func (q *Quota) since() int64 {
+	return (time.Now().Unix() - int64(q.Window/time.Second)) / quotaBucket * quotaBucket
+}
+
+// QuotaAccount is the account the usage of a request is counted to
+func QuotaAccount(c *gin.Context) string {
+	if account := c.GetString("account"); account != "" {
+		return account
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// Limit rejects the requests of the accounts exceeding their quota on
+// route, and counts the others. The bytes counted are the bytes charged by
+// ChargeQuota, or the bytes of the successful response.
+func (q *Quota) Limit(route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if q == nil {
+			c.Next()
+			return
+		}
+
+		state := &quotaState{
+			quota:   q,
+			account: QuotaAccount(c),
+			route:   route,
+			limit:   q.Limits[route],
+		}
+		// counted before it is handled, so the concurrent requests see it
+		err := state.add(1, 0)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			logger.Error(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		c.Set("quota", state)
+		c.Next()
+
+		if state.charged == 0 && c.Writer.Size() > 0 && c.Writer.Status() < http.StatusMultipleChoices {
+			addUsage(state.account, route, 0, int64(c.Writer.Size()))
+		}
+	}
+}
+
+func addUsage(account, route string, requests, bytes int64) {
+	err := database.AddUsage(account, route, time.Now().Unix()/quotaBucket*quotaBucket, requests, bytes)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// ChargeQuota charges size bytes to the account of the request before they
+// are handled, it fails if the account exceeds its quota of bytes
+func ChargeQuota(c *gin.Context, size int64) error {
+	v, ok := c.Get("quota")
+	if !ok {
+		return nil
+	}
+	state := v.(*quotaState)
+
+	err := state.add(0, size)
+	if err != nil {
+		return err
+	}
+	state.charged += size
+	return nil
+}
+
+// add counts the requests and bytes to the account unless they exceed its
+// quota, the usage is checked and counted in one transaction
+func (s *quotaState) add(requests, bytes int64) error {
+	limit := database.DAUsage{Requests: s.limit.Requests, Bytes: s.limit.Bytes}
+	s.quota.lk.Lock()
+	usage, added, err := database.AddUsageWithin(s.account, s.route, time.Now().Unix()/quotaBucket*quotaBucket, s.quota.since(), requests, bytes, limit)
+	s.quota.lk.Unlock()
+	if err != nil {
+		// the quota does not stop serving when the database fails
+		logger.Error(err)
+		return nil
+	}
+	if added {
+		return nil
+	}
+
+	if s.limit.Requests > 0 && usage.Requests+requests > s.limit.Requests {
+		return logs.QuotaExceeded{Account: s.account, Message: s.route + " requests"}
+	}
+	return logs.QuotaExceeded{Account: s.account, Message: s.route + " bytes"}
+}
+
+// Prune removes the usage out of the window periodically
+func (q *Quota) Prune(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+
+		err := database.DeleteUsageBefore(q.since())
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+// Handler returns the usage and the limits of the account in the query on
+// every route
+func (q *Quota) Handler(c *gin.Context) {
+	account := c.Query("account")
+	if account == "" {
+		account = QuotaAccount(c)
+	}
+	if q == nil {
+		errRes := logs.ToAPIErrorCode(logs.ConfigError{Message: "quota is not enabled"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	routes := make(map[string]gin.H)
+	for route, limit := range q.Limits {
+		usage, err := database.GetUsage(account, route, q.since())
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		routes[route] = gin.H{
+			"requests":      usage.Requests,
+			"bytes":         usage.Bytes,
+			"requestsLimit": limit.Requests,
+			"bytesLimit":    limit.Bytes,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account": account,
+		"window":  int64(q.Window / time.Second),
+		"routes":  routes,
+	})
+}
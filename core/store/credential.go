@@ -0,0 +1,135 @@
+package store
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/logs"
+	"github.com/memoio/meeda-node/utils"
+)
+
+// a signed put is accepted once, so it is not replayed for more credentials
+var credentialAuth = &utils.SignedRequests{Window: 5 * time.Minute, Replays: new(utils.Replays)}
+
+// the submitters allowed to obtain credentials, the submitters on chain are
+// allowed if it is empty
+var allowedSubmitters map[common.Address]bool
+
+var submittersLk sync.Mutex
+var submitters map[common.Address]bool
+var submittersAt time.Time
+var submittersTTL = time.Minute
+
+// SetCredentialAuth allows the addresses to obtain credentials, the
+// requests are signed within window. The submitters on chain are allowed
+// if allowed is empty.
+func SetCredentialAuth(allowed []common.Address, window time.Duration) {
+	allowedSubmitters = make(map[common.Address]bool)
+	for _, addr := range allowed {
+		allowedSubmitters[addr] = true
+	}
+	if window > 0 {
+		credentialAuth.Window = window
+	}
+}
+
+// authorizeCredential accepts the put requests signed by an allowed
+// submitter, whose address is set as "from"
+func authorizeCredential(c *gin.Context) {
+	from, err := credentialAuth.Authenticate(c.Request)
+	if err == utils.ErrNoCredentials {
+		err = logs.AuthenticationFailed{Message: "the request is not signed"}
+	}
+	if err == nil {
+		err = authorizeSubmitter(from)
+	}
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	// the body is staged by the authenticator, which is removed on close
+	defer c.Request.Body.Close()
+
+	c.Set("from", from)
+	c.Set("account", from.Hex())
+	c.Next()
+}
+
+func authorizeSubmitter(from common.Address) error {
+	if len(allowedSubmitters) > 0 {
+		if !allowedSubmitters[from] {
+			return logs.AuthenticationFailed{Message: from.Hex() + " is not allowed to obtain credentials"}
+		}
+		return nil
+	}
+
+	submittersLk.Lock()
+	defer submittersLk.Unlock()
+	if submitters == nil || time.Since(submittersAt) > submittersTTL {
+		info, err := defaultProofInstance.GetSubmittersInfo()
+		if err != nil {
+			return logs.EthError{Message: err.Error()}
+		}
+		submitters = map[common.Address]bool{info.MainSubmitter: true}
+		for _, addr := range info.Submitters {
+			submitters[addr] = true
+		}
+		submittersAt = time.Now()
+	}
+	if !submitters[from] {
+		return logs.AuthenticationFailed{Message: from.Hex() + " is not a submitter"}
+	}
+	return nil
+}
+
+// credentialsHandler lists the credentials issued to an account for audit
+func credentialsHandler(c *gin.Context) {
+	from := c.Query("from")
+	if !common.IsHexAddress(from) {
+		errRes := logs.ToAPIErrorCode(logs.AddressError{Message: "field 'from' is not a legal address"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "offset is not a legal number"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "limit should be between 1 and 1000"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	credentials, err := database.GetCredentialsByFrom(common.HexToAddress(from), offset, limit)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	res := make([]gin.H, 0, len(credentials))
+	for _, credential := range credentials {
+		commitBytes := credential.Commit.Bytes()
+		res = append(res, gin.H{
+			"commit":    hex.EncodeToString(commitBytes[:]),
+			"size":      credential.Size,
+			"start":     credential.Start,
+			"end":       credential.End,
+			"signature": hex.EncodeToString(credential.Signature),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"credentials": res,
+	})
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/gateway"
+)
+
+var gcBatchSize = 100
+
+// GCStats accumulates what the blob gc has done since the node started
+type GCStats struct {
+	LastRun   int64 `json:"lastRun"`
+	Purged    int64 `json:"purged"`
+	Reclaimed int64 `json:"reclaimed"`
+	Failed    int64 `json:"failed"`
+}
+
+var gcLk sync.Mutex
+var gcStats GCStats
+
+// CollectExpiredBlobs deletes the blobs expired for longer than grace from
+// the storage every interval
+func CollectExpiredBlobs(ctx context.Context, grace, interval time.Duration) {
+	for {
+		purged, reclaimed, err := collectExpiredBlobs(ctx, time.Now().Add(-grace))
+		if err != nil {
+			logger.Error(err)
+		}
+		if purged > 0 {
+			logger.Infof("gc purged %d expired blobs, reclaimed %d bytes", purged, reclaimed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func collectExpiredBlobs(ctx context.Context, deadline time.Time) (int64, int64, error) {
+	var purged, reclaimed, failed int64
+	defer func() {
+		gcLk.Lock()
+		gcStats.LastRun = time.Now().Unix()
+		gcStats.Purged += purged
+		gcStats.Reclaimed += reclaimed
+		gcStats.Failed += failed
+		gcLk.Unlock()
+	}()
+
+	// the failed files are retried in the next run
+	tried := make(map[string]struct{})
+	for {
+		files, err := database.GetExpiredFileIDInfos(deadline.Unix(), gcBatchSize+len(tried))
+		if err != nil {
+			return purged, reclaimed, err
+		}
+
+		progress := false
+		for _, file := range files {
+			if _, ok := tried[file.Mid]; ok {
+				continue
+			}
+			tried[file.Mid] = struct{}{}
+			progress = true
+
+			size, err := purgeBlob(ctx, file)
+			if err != nil {
+				logger.Errorf("gc %s: %s", file.Mid, err)
+				failed++
+				continue
+			}
+			purged++
+			reclaimed += size
+		}
+
+		if !progress || ctx.Err() != nil {
+			return purged, reclaimed, nil
+		}
+	}
+}
+
+// purgeBlob deletes the object of file and returns the bytes reclaimed
+func purgeBlob(ctx context.Context, file database.DAFileIDInfo) (int64, error) {
+	name := file.Name
+	size := file.Size
+	// ipfs only knows the cid of the object
+	if daStore.GetStoreType(ctx) == gateway.IPFS {
+		name = file.Mid
+	}
+	if name == "" {
+		// the files stored by older versions do not record the object name,
+		// which is derived from the content
+		var w bytes.Buffer
+		err := daStore.GetObject(ctx, file.Mid, &w, gateway.ObjectOptions{})
+		if err != nil {
+			if isNotExist(err) {
+				return 0, file.PurgeDAFileIDInfo()
+			}
+			return 0, err
+		}
+		name = defaultDAObject + hex.EncodeToString(crypto.Keccak256(w.Bytes()))
+		size = int64(w.Len())
+	}
+
+	// the object is shared by the commitments of its data in other encodings
+	referred, err := database.ObjectReferred(file.Commit, file.Mid, name)
+	if err != nil {
+		return 0, err
+	}
+	if referred {
+		return 0, file.PurgeDAFileIDInfo()
+	}
+
+	err = daStore.DeleteObject(ctx, defaultDABucket, name)
+	if err != nil {
+		if !isNotExist(err) {
+			return 0, err
+		}
+		size = 0
+	}
+
+	if cache, ok := daStore.(*gateway.Cache); ok {
+		cache.Evict(file.Mid)
+	}
+
+	return size, file.PurgeDAFileIDInfo()
+}
+
+// isNotExist reports whether err means the object is already deleted
+func isNotExist(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "not exist") || strings.Contains(msg, "no such") || strings.Contains(msg, "not found") || strings.Contains(msg, "not pinned")
+}
+
+func getGCStats() GCStats {
+	gcLk.Lock()
+	defer gcLk.Unlock()
+	return gcStats
+}
@@ -1,218 +1,732 @@
-package store
-
-import (
-	"bytes"
-	"encoding/hex"
-	"fmt"
-	"math/big"
-	"net/http"
-	"strings"
-	"time"
-
-	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
-	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/gin-gonic/gin"
-	"github.com/memoio/go-mefs-v2/lib/etag"
-	"github.com/memoio/meeda-node/database"
-	"github.com/memoio/meeda-node/gateway"
-	"github.com/memoio/meeda-node/logs"
-	"github.com/memoio/meeda-node/utils"
-)
-
-func LoadStoreModule(g *gin.RouterGroup) {
-	g.GET("/getObject", getObjectHandler)
-	g.POST("/putObject", putObjectHandler)
-	g.GET("/warmup", warmupHandler)
-	fmt.Println("load store node moudle success!")
-}
-
-func getObjectHandler(c *gin.Context) {
-	id := c.Query("id")
-	if len(id) == 0 {
-		lerr := logs.ServerError{Message: "object's id is not set"}
-		errRes := logs.ToAPIErrorCode(lerr)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	if len(id) == 96 {
-		commit, err := decodeCommit(id)
-		if err != nil {
-			errRes := logs.ToAPIErrorCode(err)
-			logger.Error(err)
-			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-			return
-		}
-
-		// check if it is submited to contract
-		file, err := database.GetFileInfoByCommit(commit)
-		if err != nil {
-			errRes := logs.ToAPIErrorCode(err)
-			logger.Error(err)
-			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-			return
-		}
-
-		fileID, err := database.GetFileIDInfoByCommit(file.Commit)
-		if err != nil {
-			errRes := logs.ToAPIErrorCode(err)
-			logger.Error(err)
-			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-			return
-		}
-
-		id = fileID.Mid
-	}
-
-	var w bytes.Buffer
-	err := daStore.GetObject(c.Request.Context(), id, &w, gateway.ObjectOptions{})
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(err)
-		logger.Error(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	c.Data(http.StatusOK, utils.TypeByExtension(""), w.Bytes())
-}
-
-func putObjectHandler(c *gin.Context) {
-	body := make(map[string]interface{})
-	c.BindJSON(&body)
-	data, ok := body["data"].(string)
-	if !ok {
-		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "field 'data' is not set"})
-		logger.Error("field 'data' is not set")
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-	from, ok := body["from"].(string)
-	if !ok {
-		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "field 'from' is not set"})
-		logger.Error("field 'from' is not set")
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	databyte, err := hex.DecodeString(data)
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "field 'data' is not legally hexadecimal presented"})
-		logger.Error(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	elements := utils.SplitData(databyte)
-	commit, err := kzg.Commit(elements, DefaultSRS.Pk)
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(err)
-		logger.Error(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	// check data is uploaded to meeda
-	_, err = database.GetFileInfoByCommit(commit)
-	if err == nil {
-		commitBytes := commit.Bytes()
-		commitHex := hex.EncodeToString(commitBytes[:])
-		logger.Infof("%s is already exist, so we returned", commitHex)
-		c.JSON(http.StatusOK, gin.H{
-			"id": commitHex,
-		})
-		return
-	}
-
-	object := defaultDAObject + hex.EncodeToString(crypto.Keccak256(databyte))
-
-	var buf *bytes.Buffer = bytes.NewBuffer(databyte)
-	_, err = daStore.PutObject(c.Request.Context(), defaultDABucket, object, buf, gateway.ObjectOptions{})
-	// check data is uploaded to mefs
-	if err != nil && !strings.Contains(err.Error(), "exist") {
-		errRes := logs.ToAPIErrorCode(err)
-		logger.Error(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	start := time.Now()
-	end := start.Add(defaultExpiration)
-	hash := defaultProofInstance.GetCredentialHash(common.HexToAddress(from), commit, uint64(len(databyte)), big.NewInt(start.Unix()), big.NewInt(end.Unix()))
-	signature, err := crypto.Sign(hash, submitterSk)
-	if err != nil {
-		errRes := logs.ToAPIErrorCode(err)
-		logger.Error(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	// 记录commit => mid的映射
-	mid := genCid(databyte)
-	var fileInfo = database.DAFileIDInfo{
-		Commit: commit,
-		Mid:    mid,
-	}
-	err = fileInfo.CreateDAFileIDInfo()
-	if err != nil && !strings.Contains(err.Error(), "UNIQUE constraint failed") {
-		errRes := logs.ToAPIErrorCode(err)
-		logger.Error(err)
-		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-		return
-	}
-
-	commitBytes := commit.Bytes()
-	c.JSON(http.StatusOK, gin.H{
-		"commit":    hex.EncodeToString(commitBytes[:]),
-		"size":      int64(len(databyte)),
-		"start":     start.Unix(),
-		"end":       end.Unix(),
-		"signature": hex.EncodeToString(signature),
-		"mid":       mid,
-	})
-}
-
-func warmupHandler(c *gin.Context) {
-	tempStore := daStore.(*gateway.Mefs)
-	err := tempStore.MakeBucketWithLocation(c.Request.Context(), defaultDABucket)
-	if err != nil {
-		if !strings.Contains(err.Error(), "already exist") {
-			errRes := logs.ToAPIErrorCode(err)
-			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
-			return
-		}
-	} else {
-		logger.Info("Create bucket ", defaultDABucket)
-		for !tempStore.CheckBucket(c.Request.Context(), defaultDABucket) {
-			time.Sleep(5 * time.Second)
-		}
-	}
-	c.JSON(http.StatusOK, nil)
-}
-
-func decodeCommit(id string) (bls12381.G1Affine, error) {
-	var commit bls12381.G1Affine
-	commitBytes, err := hex.DecodeString(id)
-	if err != nil {
-		return commit, err
-	}
-	_, err = commit.SetBytes(commitBytes)
-	if err != nil {
-		return commit, err
-	}
-
-	return commit, nil
-}
-
-func genCid(data []byte) string {
-	h := etag.NewTree()
-	_, err := h.Write(data)
-	if err != nil {
-		panic(err)
-	}
-	etag2 := h.Sum(nil)
-
-	etagString2, _ := etag.ToString(etag2)
-	return etagString2
-}
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/go-mefs-v2/lib/etag"
+	"github.com/memoio/meeda-node/core"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/gateway"
+	"github.com/memoio/meeda-node/logs"
+	"github.com/memoio/meeda-node/utils"
+	"gorm.io/gorm"
+)
+
+func LoadStoreModule(g *gin.RouterGroup) {
+	g.GET("/getObject", quota.Limit("getObject"), getObjectHandler)
+	g.POST("/putObject", authorizeCredential, quota.Limit("putObject"), putObjectHandler)
+	g.POST("/addNamespace", authorizeCredential, addNamespaceHandler)
+	g.GET("/getOpeningProof", getOpeningProofHandler)
+	g.GET("/getObjectInfo", getObjectInfoHandler)
+	g.GET("/listObjects", listObjectsHandler)
+	g.GET("/warmup", warmupHandler)
+	g.GET("/health", healthHandler)
+	g.GET("/cacheStats", cacheStatsHandler)
+	g.GET("/gcStats", gcStatsHandler)
+	g.GET("/info", infoHandler)
+	g.GET("/credentials", credentialsHandler)
+	g.GET("/quota", quota.Handler)
+	fmt.Println("load store node moudle success!")
+}
+
+func getObjectHandler(c *gin.Context) {
+	id := c.Query("id")
+	if len(id) == 0 {
+		lerr := logs.ServerError{Message: "object's id is not set"}
+		errRes := logs.ToAPIErrorCode(lerr)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	id, err := resolveVersionedHash(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	var meta utils.ObjectMeta
+	var size int64
+	if len(id) == 96 {
+		commit, err := decodeCommit(id)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			logger.Error(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		// check if it is submited to contract
+		file, err := database.GetFileInfoByCommit(commit)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			logger.Error(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		fileID, err := database.GetFileIDInfoByCommit(file.Commit)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			logger.Error(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		if fileID.Purged {
+			errRes := logs.ToAPIErrorCode(&logs.DataStoreError{Message: "the object is expired and purged"})
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		id = fileID.Mid
+		size = fileID.Size
+		meta = getObjectMeta(commit)
+		meta.Namespace = fileID.Namespace
+		meta.Encoding = fileID.Encoding
+		meta.Manifest = fileID.Manifest
+	}
+
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "field 'offset' is not a number"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	length, err := strconv.ParseInt(c.DefaultQuery("length", "0"), 10, 64)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "field 'length' is not a number"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	opts := gateway.ObjectOptions{Size: size, Offset: offset, Length: length}
+	w := &objectWriter{c: c, meta: meta, length: -1}
+	if size > 0 {
+		_, w.length, err = opts.Range(size)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+	}
+
+	err = daStore.GetObject(c.Request.Context(), id, w, opts)
+	if err == nil {
+		err = w.flush()
+	}
+	if err != nil {
+		logger.Error(err)
+		if w.started {
+			// the body falls short of the content length
+			c.Abort()
+			return
+		}
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+}
+
+// http.DetectContentType reads at most 512 bytes
+const sniffLen = 512
+
+// objectWriter streams the object into the response, the headers are sent
+// once the head of it is read for sniffing the content type
+type objectWriter struct {
+	c       *gin.Context
+	meta    utils.ObjectMeta
+	length  int64
+	head    []byte
+	started bool
+}
+
+func (w *objectWriter) Write(p []byte) (int, error) {
+	if w.started {
+		return w.c.Writer.Write(p)
+	}
+	w.head = append(w.head, p...)
+	if len(w.head) < sniffLen {
+		return len(p), nil
+	}
+	return len(p), w.flush()
+}
+
+func (w *objectWriter) flush() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	h := w.c.Writer.Header()
+	w.meta.SetHeaders(h, w.head)
+	if w.length >= 0 {
+		h.Set("Content-Length", strconv.FormatInt(w.length, 10))
+	}
+	w.c.Status(http.StatusOK)
+	_, err := w.c.Writer.Write(w.head)
+	w.head = nil
+	return err
+}
+
+// getObjectMeta returns the metadata of the file, which is empty if the
+// uploader attached none
+func getObjectMeta(commit bls12381.G1Affine) utils.ObjectMeta {
+	meta, err := database.GetFileMetaByCommit(commit)
+	if err != nil {
+		return utils.ObjectMeta{}
+	}
+	return utils.ObjectMeta{
+		ContentType: meta.ContentType,
+		Filename:    meta.Filename,
+		Tags:        meta.Tags,
+	}
+}
+
+func saveObjectMeta(commit bls12381.G1Affine, meta utils.ObjectMeta) {
+	if meta.IsEmpty() {
+		return
+	}
+	fileMeta := database.DAFileMeta{
+		Commit:      commit,
+		ContentType: meta.ContentType,
+		Filename:    meta.Filename,
+		Tags:        meta.Tags,
+	}
+	err := fileMeta.SaveDAFileMeta()
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func saveObjectNamespace(commit bls12381.G1Affine, namespace string) {
+	if namespace == "" {
+		return
+	}
+	err := database.AddFileNamespace(commit, namespace)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// addNamespaceHandler lists the file already stored in one more namespace,
+// for the rollup putting the same data as another one
+func addNamespaceHandler(c *gin.Context) {
+	namespace := c.Query("namespace")
+	if !utils.ValidNamespace(namespace) {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "namespace " + namespace + " is illegal"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	commit, err := decodeCommit(c.Query("id"))
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "field 'id' is not a legal commitment"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	_, err = database.GetFileIDInfoByCommit(commit)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	err = database.AddFileNamespace(commit, namespace)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":        c.Query("id"),
+		"namespace": namespace,
+	})
+}
+
+// getObjectInfoHandler returns what the store node keeps of the file
+func getObjectInfoHandler(c *gin.Context) {
+	id, err := resolveVersionedHash(c.Query("id"))
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	commit, err := decodeCommit(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "field 'id' is not a legal commitment"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	fileID, err := database.GetFileIDInfoByCommit(commit)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// the light nodes tell the files of other store nodes by 404
+		c.AbortWithStatusJSON(http.StatusNotFound, "object is not found")
+		return
+	}
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	meta := getObjectMeta(commit)
+	namespaces, err := database.GetFileNamespaces(commit)
+	if err != nil {
+		logger.Error(err)
+	}
+	if namespaces == nil {
+		namespaces = []string{}
+	}
+	// the versioned hash of a blob of EIP-4844 is the one of Ethereum
+	commitBytes := commit.Bytes()
+	versionedHash := utils.VersionedHash(commitBytes[:])
+	var blobCommitment string
+	if fileID.Encoding == utils.EncodingEIP4844 {
+		blobCommit, err := database.GetBlobCommitment(commit)
+		if err != nil {
+			logger.Error(err)
+		} else {
+			versionedHash = utils.VersionedHash(blobCommit[:])
+			blobCommitment = "0x" + hex.EncodeToString(blobCommit[:])
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":             id,
+		"versionedHash":  "0x" + hex.EncodeToString(versionedHash[:]),
+		"blobCommitment": blobCommitment,
+		"encoding":       fileID.Encoding,
+		"manifest":       fileID.Manifest,
+		"mid":            fileID.Mid,
+		"size":           fileID.Size,
+		"expiration":     fileID.Expiration,
+		"purged":         fileID.Purged,
+		"namespace":      fileID.Namespace,
+		"namespaces":     namespaces,
+		"contentType":    meta.ContentType,
+		"filename":       meta.Filename,
+		"tags":           meta.Tags,
+	})
+}
+
+// listObjectsHandler lists the files of the namespace put between from and
+// to in unix seconds
+func listObjectsHandler(c *gin.Context) {
+	namespace := c.Query("namespace")
+	if namespace != "" && !utils.ValidNamespace(namespace) {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "namespace " + namespace + " is illegal"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	from, err := strconv.ParseInt(c.DefaultQuery("from", "0"), 10, 64)
+	if err != nil || from < 0 {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "from is not a legal time"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	to, err := strconv.ParseInt(c.DefaultQuery("to", "0"), 10, 64)
+	if err != nil || to < 0 {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "to is not a legal time"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "offset is not a legal number"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "limit should be between 1 and 1000"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	files, err := database.ListFileIDInfosByNamespace(namespace, from, to, offset, limit)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	objects := make([]gin.H, 0, len(files))
+	for _, file := range files {
+		commitBytes := file.Commit.Bytes()
+		objects = append(objects, gin.H{
+			"id":         hex.EncodeToString(commitBytes[:]),
+			"size":       file.Size,
+			"expiration": file.Expiration,
+			"purged":     file.Purged,
+			"created":    file.CreatedAt,
+		})
+	}
+	res := gin.H{
+		"namespace": namespace,
+		"objects":   objects,
+	}
+	if len(files) == limit {
+		res["next"] = offset + limit
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func putObjectHandler(c *gin.Context) {
+	data, fields, err := utils.ReceiveUpload(c.Writer, c.Request, maxDataSize)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	defer data.Close()
+
+	err = core.ChargeQuota(c, data.Size)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	// the credential is issued to the signer of the request
+	from := c.MustGet("from").(common.Address)
+	if f, ok := fields["from"]; ok && common.HexToAddress(f) != from {
+		errRes := logs.ToAPIErrorCode(logs.AuthenticationFailed{Message: "field 'from' is not the signer " + from.Hex()})
+		logger.Error("field 'from' is not the signer ", from.Hex())
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	meta, err := utils.MetaFromFields(fields)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	// the light nodes tell the manifests of large objects
+	meta.Manifest = fields["manifest"] == "true"
+
+	elements, blob, err := encodeUpload(data, meta.Encoding)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	commit, err := kzg.Commit(elements, DefaultSRS.Pk)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	if blob != nil {
+		err = saveBlobCommitment(commit, blob)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			logger.Error(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+	}
+
+	// check data is uploaded to meeda and still kept
+	_, err = database.GetFileInfoByCommit(commit)
+	fileID, ierr := database.GetFileIDInfoByCommit(commit)
+	if err == nil && (ierr != nil || !fileID.Purged) {
+		// the metadata is the one of the first upload, while the data is
+		// listed in the namespaces of all the uploads
+		saveObjectNamespace(commit, meta.Namespace)
+		commitBytes := commit.Bytes()
+		commitHex := hex.EncodeToString(commitBytes[:])
+		logger.Infof("%s is already exist, so we returned", commitHex)
+		c.JSON(http.StatusOK, gin.H{
+			"id": commitHex,
+		})
+		return
+	}
+
+	// the objects of a namespace are named after it instead of da-txdata
+	object := defaultDAObject + hex.EncodeToString(data.Hash)
+	if meta.Namespace != "" {
+		object = meta.Namespace + "/" + hex.EncodeToString(data.Hash)
+	}
+
+	var objInfo gateway.ObjectInfo
+	if ierr == nil && !fileID.Purged && fileID.Name != "" {
+		// the data is put again before its AddFile is indexed, maybe in
+		// another namespace, and the object stored first is kept
+		object = fileID.Name
+		objInfo.Cid = fileID.Mid
+	} else {
+		r, err := data.Reader()
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			logger.Error(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		objInfo, err = daStore.PutObject(c.Request.Context(), defaultDABucket, object, r, gateway.ObjectOptions{Size: data.Size, UserDefined: meta.Fields()})
+		// check data is uploaded to mefs
+		if err != nil && !strings.Contains(err.Error(), "exist") {
+			errRes := logs.ToAPIErrorCode(err)
+			logger.Error(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+	}
+
+	start := time.Now()
+	end := start.Add(defaultExpiration)
+	hash := defaultProofInstance.GetCredentialHash(from, commit, uint64(data.Size), big.NewInt(start.Unix()), big.NewInt(end.Unix()))
+	signature, err := crypto.Sign(hash, submitterSk)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	// every credential issued is recorded for audit
+	credential := database.DACredentialInfo{
+		Commit:    commit,
+		From:      from,
+		Size:      data.Size,
+		Start:     start.Unix(),
+		End:       end.Unix(),
+		Signature: signature,
+	}
+	err = credential.CreateDACredential()
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	// 记录commit => mid的映射
+	mid := objInfo.Cid
+	if mid == "" {
+		// the object is already in mefs, whose cid is the etag of data
+		r, err := data.Reader()
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			logger.Error(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		mid, err = genCid(r)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			logger.Error(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+	}
+	var fileInfo = database.DAFileIDInfo{
+		Commit:     commit,
+		Mid:        mid,
+		Name:       object,
+		Namespace:  meta.Namespace,
+		Encoding:   meta.Encoding,
+		Manifest:   meta.Manifest,
+		Size:       data.Size,
+		Expiration: end.Unix(),
+	}
+	err = fileInfo.CreateDAFileIDInfo()
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		// the object may be stored again after it is purged, otherwise it
+		// is put meanwhile and the object stored first is kept
+		stored, serr := database.GetFileIDInfoByCommit(commit)
+		if serr == nil && !stored.Purged && stored.Name != "" {
+			fileInfo.Mid = stored.Mid
+			fileInfo.Name = stored.Name
+			fileInfo.Namespace = stored.Namespace
+			mid = stored.Mid
+		}
+		err = fileInfo.UpdateDAFileIDInfo()
+	}
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	saveObjectMeta(commit, meta)
+	saveObjectNamespace(commit, meta.Namespace)
+
+	commitBytes := commit.Bytes()
+	c.JSON(http.StatusOK, gin.H{
+		"commit":    hex.EncodeToString(commitBytes[:]),
+		"size":      data.Size,
+		"start":     start.Unix(),
+		"end":       end.Unix(),
+		"signature": hex.EncodeToString(signature),
+		"mid":       mid,
+	})
+}
+
+func warmupHandler(c *gin.Context) {
+	// only some storages need to create and confirm the bucket in advance
+	tempStore, ok := gateway.Unwrap(daStore).(interface {
+		MakeBucketWithLocation(context.Context, string) error
+		CheckBucket(context.Context, string) bool
+	})
+	if !ok {
+		c.JSON(http.StatusOK, nil)
+		return
+	}
+	err := tempStore.MakeBucketWithLocation(c.Request.Context(), defaultDABucket)
+	if err != nil {
+		if !strings.Contains(err.Error(), "already exist") {
+			errRes := logs.ToAPIErrorCode(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+	} else {
+		logger.Info("Create bucket ", defaultDABucket)
+		for !tempStore.CheckBucket(c.Request.Context(), defaultDABucket) {
+			time.Sleep(5 * time.Second)
+		}
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
+func healthHandler(c *gin.Context) {
+	if h, ok := daStore.(gateway.IHealth); ok {
+		err := h.Health(c.Request.Context())
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"storage": daStore.GetStoreType(c.Request.Context()).String(),
+		"status":  "ok",
+	})
+}
+
+func cacheStatsHandler(c *gin.Context) {
+	cache, ok := daStore.(*gateway.Cache)
+	if !ok {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "blob cache is not enabled"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, cache.Stats())
+}
+
+func infoHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"maxSize":     maxDataSize,
+		"srsSize":     len(DefaultSRS.Pk.G1),
+		"shardingLen": utils.ShardingLen,
+		"storage":     daStore.GetStoreType(c.Request.Context()).String(),
+	})
+}
+
+func gcStatsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, getGCStats())
+}
+
+// encodeUpload returns the elements of data in the encoding, the ones of
+// meeda are computed while it is received. The data of a blob of EIP-4844
+// is returned too, which is nil in the other encodings.
+func encodeUpload(data *utils.SpooledData, encoding string) ([]fr.Element, []byte, error) {
+	if encoding != utils.EncodingEIP4844 {
+		return data.Elements, nil, nil
+	}
+	if data.Size > utils.MaxBlobDataSize {
+		return nil, nil, logs.DataTooLarge{Size: data.Size, Limit: utils.MaxBlobDataSize}
+	}
+	r, err := data.Reader()
+	if err != nil {
+		return nil, nil, err
+	}
+	blob, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return utils.SplitBlob(blob), blob, nil
+}
+
+// saveBlobCommitment records the commitment of Ethereum of the blob, whose
+// commitment of meeda is commit
+func saveBlobCommitment(commit bls12381.G1Affine, blob []byte) error {
+	blobCommit, err := utils.BlobCommitment(blob)
+	if err != nil {
+		return err
+	}
+	err = database.SaveBlobCommitment(commit, blobCommit)
+	if err != nil {
+		return logs.DataBaseError{Message: err.Error()}
+	}
+	return nil
+}
+
+// resolveVersionedHash returns the hex of the commitment whose versioned
+// hash is id, or id itself if it is not a versioned hash. The versioned
+// hashes of the blobs of EIP-4844 are the ones of Ethereum.
+func resolveVersionedHash(id string) (string, error) {
+	versionedHash, ok := utils.ParseVersionedHash(id)
+	if !ok {
+		return id, nil
+	}
+	commit, err := database.GetCommitByBlobVersionedHash(versionedHash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var file database.DAFileInfo
+		file, err = database.GetFileInfoByVersionedHash(versionedHash)
+		commit = file.Commit
+	}
+	if err != nil {
+		return id, err
+	}
+	commitBytes := commit.Bytes()
+	return hex.EncodeToString(commitBytes[:]), nil
+}
+
+func decodeCommit(id string) (bls12381.G1Affine, error) {
+	var commit bls12381.G1Affine
+	commitBytes, err := hex.DecodeString(id)
+	if err != nil {
+		return commit, err
+	}
+	_, err = commit.SetBytes(commitBytes)
+	if err != nil {
+		return commit, err
+	}
+
+	return commit, nil
+}
+
+func genCid(r io.Reader) (string, error) {
+	h := etag.NewTree()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	etag2 := h.Sum(nil)
+
+	return etag.ToString(etag2)
+}
@@ -1,62 +1,115 @@
-package store
-
-import (
-	"crypto/ecdsa"
-	"time"
-
-	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
-	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
-	dkzg "github.com/memoio/did-solidity/kzg"
-	proof "github.com/memoio/go-did/file-proof"
-	"github.com/memoio/meeda-node/gateway"
-	"github.com/memoio/meeda-node/logs"
-)
-
-var DefaultSRS *kzg.SRS
-var zeroCommit bls12381.G1Affine
-var zeroProof kzg.OpeningProof
-
-var defaultProofInstance *proof.ProofInstance
-var submitterSk *ecdsa.PrivateKey
-var daStore gateway.IGateway
-var logger = logs.Logger("store node")
-var defaultDABucket string = "da-bucket"
-var defaultDAObject string = "da-txdata"
-var defaultExpiration time.Duration = 7 * 24 * time.Hour
-
-func InitStoreNode(chain string, sk *ecdsa.PrivateKey, api, token string, addrs *proof.ContractAddress) error {
-	if api == "" {
-		store, err := gateway.NewGateway()
-		if err != nil {
-			return err
-		}
-		daStore = store
-	} else {
-		store, err := gateway.CreateGateWay(api, token)
-		if err != nil {
-			return err
-		}
-		daStore = store
-	}
-
-	key, err := dkzg.InitKey()
-	if err != nil {
-		return err
-	}
-
-	DefaultSRS = &kzg.SRS{
-		Pk: key.Pk,
-		Vk: key.Vk,
-	}
-
-	zeroCommit.X.SetZero()
-	zeroCommit.Y.SetZero()
-
-	zeroProof.ClaimedValue.SetZero()
-	zeroProof.H.X.SetZero()
-	zeroProof.H.Y.SetZero()
-
-	submitterSk = sk
-	defaultProofInstance, err = proof.NewProofInstance(sk, chain, addrs)
-	return err
-}
+package store
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"time"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
+	dkzg "github.com/memoio/did-solidity/kzg"
+	proof "github.com/memoio/go-did/file-proof"
+	"github.com/memoio/meeda-node/core"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/gateway"
+	"github.com/memoio/meeda-node/logs"
+	"github.com/memoio/meeda-node/utils"
+	"golang.org/x/xerrors"
+)
+
+var DefaultSRS *kzg.SRS
+var zeroCommit bls12381.G1Affine
+var zeroProof kzg.OpeningProof
+
+var defaultProofInstance *proof.ProofInstance
+var submitterSk *ecdsa.PrivateKey
+var daStore gateway.IGateway
+var logger = logs.Logger("store node")
+var defaultDABucket string = "da-bucket"
+var defaultDAObject string = "da-txdata"
+var defaultExpiration time.Duration = 7 * 24 * time.Hour
+var maxDataSize int64
+var quota *core.Quota
+
+func InitStoreNode(chain string, sk *ecdsa.PrivateKey, storeCfg gateway.Config, addrs *proof.ContractAddress) error {
+	store, err := gateway.OpenGateway(storeCfg)
+	if err != nil {
+		return err
+	}
+	daStore = store
+
+	key, err := dkzg.InitKey()
+	if err != nil {
+		return err
+	}
+
+	DefaultSRS = &kzg.SRS{
+		Pk: key.Pk,
+		Vk: key.Vk,
+	}
+
+	SetMaxDataSize(0)
+
+	zeroCommit.X.SetZero()
+	zeroCommit.Y.SetZero()
+
+	zeroProof.ClaimedValue.SetZero()
+	zeroProof.H.X.SetZero()
+	zeroProof.H.Y.SetZero()
+
+	submitterSk = sk
+	defaultProofInstance, err = proof.NewProofInstance(sk, chain, addrs)
+	return err
+}
+
+// SetMaxDataSize limits the size of data put, the size that the SRS can
+// commit is used if size is not positive or larger than it
+func SetMaxDataSize(size int64) {
+	maxDataSize = utils.MaxDataSize(len(DefaultSRS.Pk.G1))
+	if size > 0 && size < maxDataSize {
+		maxDataSize = size
+	}
+	// the body of a put request is hashed before it is received, the hex
+	// encoded json doubles the size of data
+	credentialAuth.MaxBody = 2*maxDataSize + 1<<20
+}
+
+// SetQuota limits the usage of every account, there is no limit if q is nil
+func SetQuota(q *core.Quota) {
+	quota = q
+}
+
+// EnableDACache serves the hot blobs from a disk cache of capacity bytes in
+// front of the storage
+func EnableDACache(path string, capacity int64) error {
+	cache, err := gateway.NewCache(daStore, path, capacity)
+	if err != nil {
+		return err
+	}
+	cache.SetVerifier(verifyBlob)
+	daStore = cache
+	return nil
+}
+
+// verifyBlob checks data against the commitment indexed for mid
+func verifyBlob(mid string, data []byte) error {
+	fileID, err := database.GetFileIDInfoByMid(mid)
+	if err != nil {
+		return err
+	}
+	commit, err := kzg.Commit(utils.SplitDataAs(fileID.Encoding, data), DefaultSRS.Pk)
+	if err != nil {
+		return err
+	}
+	if !commit.Equal(&fileID.Commit) {
+		return xerrors.Errorf("commitment of %s mismatch", mid)
+	}
+	return nil
+}
+
+// RepairDAStore fills in the missing replicas when blobs are replicated
+func RepairDAStore(ctx context.Context) {
+	if r, ok := gateway.Unwrap(daStore).(*gateway.Replicated); ok {
+		r.Repair(ctx)
+	}
+}
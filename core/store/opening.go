@@ -0,0 +1,109 @@
+package store
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/gateway"
+	"github.com/memoio/meeda-node/logs"
+	"github.com/memoio/meeda-node/utils"
+	"golang.org/x/xerrors"
+	"gorm.io/gorm"
+)
+
+// NoncePoint derives the evaluation point of an opening from the nonce of
+// the client, which is keccak256(commitment || nonce) reduced into fr
+func NoncePoint(commitBytes []byte, nonce string) fr.Element {
+	var point fr.Element
+	point.SetBytes(crypto.Keccak256(commitBytes, []byte(nonce)))
+	return point
+}
+
+// getOpeningProofHandler opens the polynomial of a blob at the point, or at
+// the point derived from the nonce, so the client can check that the blob
+// is kept by kzg.Verify without downloading it
+func getOpeningProofHandler(c *gin.Context) {
+	id, err := resolveVersionedHash(c.Query("id"))
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	commit, err := decodeCommit(id)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "field 'id' is not a legal commitment"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	var point fr.Element
+	if p, ok := c.GetQuery("point"); ok {
+		_, err = point.SetString(p)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "field 'point' is not a legal field element"})
+			c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+	} else if nonce, ok := c.GetQuery("nonce"); ok {
+		commitBytes := commit.Bytes()
+		point = NoncePoint(commitBytes[:], nonce)
+	} else {
+		errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "field 'point' or 'nonce' is not set"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	fileID, err := database.GetFileIDInfoByCommit(commit)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, "object is not found")
+		return
+	}
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	if fileID.Purged {
+		errRes := logs.ToAPIErrorCode(&logs.DataStoreError{Message: "the object is expired and purged"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	var w bytes.Buffer
+	err = daStore.GetObject(c.Request.Context(), fileID.Mid, &w, gateway.ObjectOptions{Size: fileID.Size})
+	if err == nil && fileID.Size > 0 && int64(w.Len()) != fileID.Size {
+		err = xerrors.Errorf("get %d bytes of %s, expected %d", w.Len(), fileID.Mid, fileID.Size)
+	}
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	proof, err := kzg.Open(utils.SplitDataAs(fileID.Encoding, w.Bytes()), point, DefaultSRS.Pk)
+	if err != nil {
+		errRes := logs.ToAPIErrorCode(err)
+		logger.Error(err)
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+
+	pointBytes := point.Bytes()
+	valueBytes := proof.ClaimedValue.Bytes()
+	hBytes := proof.H.Bytes()
+	c.JSON(http.StatusOK, gin.H{
+		"id":    id,
+		"point": hex.EncodeToString(pointBytes[:]),
+		"value": hex.EncodeToString(valueBytes[:]),
+		"h":     hex.EncodeToString(hBytes[:]),
+	})
+}
@@ -0,0 +1,275 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr/kzg"
+	"github.com/ethereum/go-ethereum/crypto"
+	dkzg "github.com/memoio/did-solidity/kzg"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/gateway"
+	"github.com/memoio/meeda-node/utils"
+	"golang.org/x/xerrors"
+)
+
+type ReconcileOptions struct {
+	// index the orphaned blobs by their commitments
+	Reindex bool
+	// fetch the missing blobs from Source and upload them again
+	Reupload bool
+	// url of another store node holding the blobs, e.g.(http://127.0.0.1:8081)
+	Source string
+}
+
+type ReconcileReport struct {
+	Objects int
+	Indexed int
+	// blobs in da-bucket which no commitment refers to
+	Orphaned []gateway.ObjectInfo
+	// commitments whose blobs are not in da-bucket and not purged
+	Missing []database.DAFileIDInfo
+	// commitments submitted to the contract which are not indexed
+	Unindexed []database.DAFileInfo
+
+	Reindexed  int
+	Reuploaded int
+	Failed     int
+}
+
+// Reconcile compares the blobs in da-bucket with the DAFileIDInfoStore and
+// DAFileInfoStore tables, and repairs them if asked
+func Reconcile(ctx context.Context, storeCfg gateway.Config, opts ReconcileOptions) (*ReconcileReport, error) {
+	if opts.Reupload && opts.Source == "" {
+		return nil, xerrors.New("source store node is not set for reupload")
+	}
+
+	store, err := gateway.OpenGateway(storeCfg)
+	if err != nil {
+		return nil, err
+	}
+	daStore = store
+
+	if opts.Reindex || opts.Reupload {
+		key, err := dkzg.InitKey()
+		if err != nil {
+			return nil, err
+		}
+		DefaultSRS = &kzg.SRS{
+			Pk: key.Pk,
+			Vk: key.Vk,
+		}
+	}
+
+	report := new(ReconcileReport)
+
+	objects := make(map[string]gateway.ObjectInfo)
+	// the objects of namespaces are not prefixed with da-txdata, so all the
+	// objects in da-bucket are listed
+	opt := gateway.ListObjectsOptions{}
+	for {
+		loi, err := daStore.ListObjects(ctx, defaultDABucket, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, oi := range loi.Objects {
+			objects[oi.Cid] = oi
+		}
+		if !loi.IsTruncated {
+			break
+		}
+		opt.Marker = loi.NextMarker
+	}
+	report.Objects = len(objects)
+
+	fileIDs, err := database.ListFileIDInfos()
+	if err != nil {
+		return nil, err
+	}
+	indexed := make(map[bls12381.G1Affine]database.DAFileIDInfo, len(fileIDs))
+	mids := make(map[string]struct{}, len(fileIDs))
+	for _, fileID := range fileIDs {
+		indexed[fileID.Commit] = fileID
+		mids[fileID.Mid] = struct{}{}
+		// the blobs of purged files are deleted on purpose
+		if _, ok := objects[fileID.Mid]; !ok && !fileID.Purged {
+			report.Missing = append(report.Missing, fileID)
+		}
+	}
+	report.Indexed = len(fileIDs)
+
+	for cid, oi := range objects {
+		if _, ok := mids[cid]; !ok {
+			report.Orphaned = append(report.Orphaned, oi)
+		}
+	}
+
+	files, err := database.ListFileInfos()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if _, ok := indexed[file.Commit]; !ok {
+			report.Unindexed = append(report.Unindexed, file)
+		}
+	}
+
+	if opts.Reindex {
+		for _, oi := range report.Orphaned {
+			commit, err := reindexObject(ctx, oi, indexed)
+			if err != nil {
+				logger.Errorf("reindex %s: %s", oi.Name, err)
+				report.Failed++
+				continue
+			}
+			indexed[commit] = database.DAFileIDInfo{Commit: commit, Mid: oi.Cid}
+			report.Reindexed++
+		}
+	}
+
+	if opts.Reupload {
+		var lost []bls12381.G1Affine
+		for _, fileID := range report.Missing {
+			lost = append(lost, fileID.Commit)
+		}
+		for _, file := range report.Unindexed {
+			lost = append(lost, file.Commit)
+		}
+
+		for _, commit := range lost {
+			// the blob may be found among the orphans above
+			if fileID, ok := indexed[commit]; ok {
+				if _, ok := objects[fileID.Mid]; ok {
+					continue
+				}
+			}
+			mid, err := reuploadObject(ctx, opts.Source, commit, indexed)
+			if err != nil {
+				logger.Errorf("reupload %s: %s", commitHex(commit), err)
+				report.Failed++
+				continue
+			}
+			indexed[commit] = database.DAFileIDInfo{Commit: commit, Mid: mid}
+			report.Reuploaded++
+		}
+	}
+
+	return report, nil
+}
+
+// reindexObject computes the commitment of an orphaned blob and points the
+// commitment to it
+func reindexObject(ctx context.Context, oi gateway.ObjectInfo, indexed map[bls12381.G1Affine]database.DAFileIDInfo) (bls12381.G1Affine, error) {
+	var w bytes.Buffer
+	err := daStore.GetObject(ctx, oi.Cid, &w, gateway.ObjectOptions{Size: oi.Size})
+	if err != nil {
+		return zeroCommit, err
+	}
+
+	// the encoding is kept in the user defined metadata of the object
+	encoding := oi.UserDefined["encoding"]
+	commit, err := kzg.Commit(utils.SplitDataAs(encoding, w.Bytes()), DefaultSRS.Pk)
+	if err != nil {
+		return zeroCommit, err
+	}
+	if encoding == utils.EncodingEIP4844 {
+		err = saveBlobCommitment(commit, w.Bytes())
+		if err != nil {
+			return zeroCommit, err
+		}
+	}
+
+	fileID := database.DAFileIDInfo{
+		Commit:   commit,
+		Mid:      oi.Cid,
+		Name:     oi.Name,
+		Encoding: encoding,
+		Manifest: oi.UserDefined["manifest"] == "true",
+		Size:     int64(w.Len()),
+	}
+	if _, ok := indexed[commit]; ok {
+		return commit, fileID.UpdateDAFileIDInfo()
+	}
+	return commit, fileID.CreateDAFileIDInfo()
+}
+
+// reuploadObject fetches the blob of commit from another store node, checks
+// it against commit and puts it into da-bucket
+func reuploadObject(ctx context.Context, source string, commit bls12381.G1Affine, indexed map[bls12381.G1Affine]database.DAFileIDInfo) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	u := strings.TrimSuffix(source, "/") + "/getObject?id=" + url.QueryEscape(commitHex(commit))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", xerrors.Errorf("%s: %s", res.Status, data)
+	}
+
+	// the source tells the encoding, which is checked by the commitment
+	meta := utils.MetaFromHeaders(res.Header)
+	encoding := meta.Encoding
+	got, err := kzg.Commit(utils.SplitDataAs(encoding, data), DefaultSRS.Pk)
+	if err != nil {
+		return "", err
+	}
+	if !got.Equal(&commit) {
+		return "", xerrors.New("the blob fetched from source does not match the commitment")
+	}
+	if encoding == utils.EncodingEIP4844 {
+		err = saveBlobCommitment(commit, data)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	object := defaultDAObject + hex.EncodeToString(crypto.Keccak256(data))
+	objInfo, err := daStore.PutObject(ctx, defaultDABucket, object, bytes.NewReader(data), gateway.ObjectOptions{Size: int64(len(data))})
+	if err != nil && !strings.Contains(err.Error(), "exist") {
+		return "", err
+	}
+	mid := objInfo.Cid
+	if mid == "" {
+		mid, err = genCid(bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	fileID := database.DAFileIDInfo{
+		Commit:   commit,
+		Mid:      mid,
+		Name:     object,
+		Encoding: encoding,
+		Manifest: meta.Manifest,
+		Size:     int64(len(data)),
+	}
+	if _, ok := indexed[commit]; ok {
+		return mid, fileID.UpdateDAFileIDInfo()
+	}
+	return mid, fileID.CreateDAFileIDInfo()
+}
+
+func commitHex(commit bls12381.G1Affine) string {
+	commitBytes := commit.Bytes()
+	return hex.EncodeToString(commitBytes[:])
+}
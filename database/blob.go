@@ -0,0 +1,57 @@
+package database
+
+import (
+	"encoding/hex"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DABlobCommitmentStore records the commitments of Ethereum of the files
+// in the encoding of EIP-4844, the files are added on chain by the
+// commitments of meeda
+type DABlobCommitmentStore struct {
+	gorm.Model
+	Commitment     string `gorm:"uniqueIndex;column:commitment"`
+	BlobCommitment string
+	VersionedHash  string `gorm:"index"`
+}
+
+func InitDABlobCommitmentTable() error {
+	return GlobalDataBase.AutoMigrate(&DABlobCommitmentStore{})
+}
+
+func SaveBlobCommitment(commit bls12381.G1Affine, blobCommit [48]byte) error {
+	commitByte48 := commit.Bytes()
+	var info = &DABlobCommitmentStore{
+		Commitment:     hex.EncodeToString(commitByte48[:]),
+		BlobCommitment: hex.EncodeToString(blobCommit[:]),
+		VersionedHash:  versionedHashOf(blobCommit[:]),
+	}
+	return GlobalDataBase.Clauses(clause.OnConflict{DoNothing: true}).Create(info).Error
+}
+
+// GetBlobCommitment returns the commitment of Ethereum of the file of commit
+func GetBlobCommitment(commit bls12381.G1Affine) ([48]byte, error) {
+	var blobCommit [48]byte
+	var info DABlobCommitmentStore
+	commitByte48 := commit.Bytes()
+	err := GlobalDataBase.Model(&DABlobCommitmentStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).First(&info).Error
+	if err != nil {
+		return blobCommit, err
+	}
+	_, err = hex.Decode(blobCommit[:], []byte(info.BlobCommitment))
+	return blobCommit, err
+}
+
+// GetCommitByBlobVersionedHash finds the file whose commitment of Ethereum
+// has the versioned hash
+func GetCommitByBlobVersionedHash(versionedHash [32]byte) (bls12381.G1Affine, error) {
+	var info DABlobCommitmentStore
+	err := GlobalDataBase.Model(&DABlobCommitmentStore{}).Where("versioned_hash = ?", hex.EncodeToString(versionedHash[:])).First(&info).Error
+	if err != nil {
+		return bls12381.G1Affine{}, err
+	}
+	return decodeCommitment(info.Commitment)
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"encoding/hex"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+)
+
+// DACredentialInfo is a credential signed by the store node, with which
+// From adds the file to the contract
+type DACredentialInfo struct {
+	Commit    bls12381.G1Affine
+	From      common.Address
+	Size      int64
+	Start     int64
+	End       int64
+	Signature []byte
+}
+
+type DACredentialStore struct {
+	gorm.Model
+	Commitment string `gorm:"index;column:commitment"`
+	Account    string `gorm:"index"`
+	Size       int64
+	Start      int64
+	End        int64
+	Signature  string
+}
+
+func InitDACredentialTable() error {
+	return GlobalDataBase.AutoMigrate(&DACredentialStore{})
+}
+
+func (c *DACredentialInfo) CreateDACredential() error {
+	commitByte48 := c.Commit.Bytes()
+	var info = &DACredentialStore{
+		Commitment: hex.EncodeToString(commitByte48[:]),
+		Account:    c.From.Hex(),
+		Size:       c.Size,
+		Start:      c.Start,
+		End:        c.End,
+		Signature:  hex.EncodeToString(c.Signature),
+	}
+	return GlobalDataBase.Create(info).Error
+}
+
+func GetCredentialsByFrom(from common.Address, offset, limit int) ([]DACredentialInfo, error) {
+	var infos []DACredentialStore
+	err := GlobalDataBase.Model(&DACredentialStore{}).Where("account = ?", from.Hex()).Order("id").Offset(offset).Limit(limit).Find(&infos).Error
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]DACredentialInfo, 0, len(infos))
+	for _, info := range infos {
+		commit, err := decodeCommitment(info.Commitment)
+		if err != nil {
+			return nil, err
+		}
+		signature, err := hex.DecodeString(info.Signature)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, DACredentialInfo{
+			Commit:    commit,
+			From:      common.HexToAddress(info.Account),
+			Size:      info.Size,
+			Start:     info.Start,
+			End:       info.End,
+			Signature: signature,
+		})
+	}
+	return credentials, nil
+}
@@ -1,110 +1,288 @@
-package database
-
-import (
-	"encoding/hex"
-
-	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
-	"gorm.io/gorm"
-)
-
-type DAFileInfo struct {
-	// gorm.Model
-	Commit              bls12381.G1Affine
-	Size                int64
-	Expiration          int64
-	ChooseNumber        int64
-	ProvedSuccessNumber int64
-}
-
-type DAFileInfoStore struct {
-	gorm.Model
-	Commitment          string `gorm:"uniqueIndex;column:commitment"`
-	Size                int64
-	Expiration          int64
-	ChooseNumber        int64
-	ProvedSuccessNumber int64
-}
-
-func InitDAFileInfoTable() error {
-	return GlobalDataBase.AutoMigrate(&DAFileInfoStore{})
-}
-
-func (f *DAFileInfo) CreateDAFileInfo() error {
-	commitByte48 := f.Commit.Bytes()
-	var info = &DAFileInfoStore{
-		Commitment:     hex.EncodeToString(commitByte48[:]),
-		Size:       f.Size,
-		Expiration: f.Expiration,
-	}
-	return GlobalDataBase.Create(info).Error
-}
-
-func (f *DAFileInfo) UpdateDAFileInfo() error {
-	commitByte48 := f.Commit.Bytes()
-	commit := hex.EncodeToString(commitByte48[:])
-
-	return GlobalDataBase.Model(&DAFileInfoStore{}).Where("commitment = ?", commit).Updates(map[string]interface{}{"choose_number": f.ChooseNumber, "proved_success_number": f.ChooseNumber}).Error
-}
-
-func GetDAFileLength() (int64, error) {
-	var length int64
-	err := GlobalDataBase.Model(&DAFileInfoStore{}).Count(&length).Error
-	return length, err
-}
-
-func GetFileInfoByID(id uint) (DAFileInfo, error) {
-	var file DAFileInfoStore
-	err := GlobalDataBase.Model(&DAFileInfoStore{}).Where("id = ?", id).First(&file).Error
-	if err != nil {
-		return DAFileInfo{}, err
-	}
-
-	commitByte48, err := hex.DecodeString(file.Commitment)
-	if err != nil {
-		return DAFileInfo{}, err
-	}
-	var commit bls12381.G1Affine
-	_, err = commit.SetBytes(commitByte48)
-	if err != nil {
-		return DAFileInfo{}, err
-	}
-
-	return DAFileInfo{
-		Commit:              commit,
-		Size:                file.Size,
-		Expiration:          file.Expiration,
-		ChooseNumber:        file.ChooseNumber,
-		ProvedSuccessNumber: file.ProvedSuccessNumber,
-	}, nil
-}
-
-func GetFileInfoByCommit(commit bls12381.G1Affine) (DAFileInfo, error) {
-	var file DAFileInfoStore
-	commitByte48 := commit.Bytes()
-	err := GlobalDataBase.Model(&DAFileInfoStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).First(&file).Error
-
-	return DAFileInfo{
-		Commit:              commit,
-		Size:                file.Size,
-		Expiration:          file.Expiration,
-		ChooseNumber:        file.ChooseNumber,
-		ProvedSuccessNumber: file.ProvedSuccessNumber,
-	}, err
-}
-
-// func GetFileByCommit(commit bls12381.G1Affine) ([]byte, error) {
-// 	var file DAFileInfo
-// 	var buf bytes.Buffer
-// 	commitByte48 := commit.Bytes()
-// 	err := GlobalDataBase.Model(&DAFileInfoStore{}).Where("\"commit\" = ?", hex.EncodeToString(commitByte48[:])).First(&file).Error
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	err = daStore.GetObject(context.TODO(), file.Mid, &buf, gateway.ObjectOptions{})
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	return buf.Bytes(), nil
-// }
+package database
+
+import (
+	"encoding/hex"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/memoio/meeda-node/utils"
+	"gorm.io/gorm"
+)
+
+type DAFileInfo struct {
+	// gorm.Model
+	Commit              bls12381.G1Affine
+	Size                int64
+	Expiration          int64
+	ChooseNumber        int64
+	ProvedSuccessNumber int64
+	// the block in which the file is added, 0 if it is indexed before the
+	// block is recorded until the dumper fills it
+	BlockNumber int64
+	// the versioned hash of EIP-4844 of the commitment
+	VersionedHash [32]byte
+}
+
+type DAFileInfoStore struct {
+	gorm.Model
+	Commitment          string `gorm:"uniqueIndex;column:commitment"`
+	Size                int64
+	Expiration          int64
+	ChooseNumber        int64
+	ProvedSuccessNumber int64
+	BlockNumber         int64  `gorm:"index"`
+	VersionedHash       string `gorm:"index"`
+}
+
+func InitDAFileInfoTable() error {
+	return GlobalDataBase.AutoMigrate(&DAFileInfoStore{})
+}
+
+func (f *DAFileInfo) CreateDAFileInfo() error {
+	commitByte48 := f.Commit.Bytes()
+	var info = &DAFileInfoStore{
+		Commitment:    hex.EncodeToString(commitByte48[:]),
+		Size:          f.Size,
+		Expiration:    f.Expiration,
+		BlockNumber:   f.BlockNumber,
+		VersionedHash: versionedHashOf(commitByte48[:]),
+	}
+	return GlobalDataBase.Create(info).Error
+}
+
+// CountFilesWithoutBlock counts the files indexed before the block is
+// recorded
+func CountFilesWithoutBlock() (int64, error) {
+	var count int64
+	err := GlobalDataBase.Model(&DAFileInfoStore{}).Where("block_number = ?", 0).Count(&count).Error
+	return count, err
+}
+
+// SetFileBlockNumber sets the block of the file if it is indexed before the
+// block is recorded
+func SetFileBlockNumber(commit bls12381.G1Affine, blockNumber int64) error {
+	commitByte48 := commit.Bytes()
+	return GlobalDataBase.Model(&DAFileInfoStore{}).Where("commitment = ? AND block_number = ?", hex.EncodeToString(commitByte48[:]), 0).
+		Update("block_number", blockNumber).Error
+}
+
+func (f *DAFileInfo) UpdateDAFileInfo() error {
+	commitByte48 := f.Commit.Bytes()
+	commit := hex.EncodeToString(commitByte48[:])
+
+	return GlobalDataBase.Model(&DAFileInfoStore{}).Where("commitment = ?", commit).Updates(map[string]interface{}{"choose_number": f.ChooseNumber, "proved_success_number": f.ChooseNumber}).Error
+}
+
+func GetDAFileLength() (int64, error) {
+	var length int64
+	err := GlobalDataBase.Model(&DAFileInfoStore{}).Count(&length).Error
+	return length, err
+}
+
+func GetFileInfoByID(id uint) (DAFileInfo, error) {
+	var file DAFileInfoStore
+	err := GlobalDataBase.Model(&DAFileInfoStore{}).Where("id = ?", id).First(&file).Error
+	if err != nil {
+		return DAFileInfo{}, err
+	}
+
+	commitByte48, err := hex.DecodeString(file.Commitment)
+	if err != nil {
+		return DAFileInfo{}, err
+	}
+	var commit bls12381.G1Affine
+	_, err = commit.SetBytes(commitByte48)
+	if err != nil {
+		return DAFileInfo{}, err
+	}
+
+	return DAFileInfo{
+		Commit:              commit,
+		Size:                file.Size,
+		Expiration:          file.Expiration,
+		ChooseNumber:        file.ChooseNumber,
+		ProvedSuccessNumber: file.ProvedSuccessNumber,
+		BlockNumber:         file.BlockNumber,
+		VersionedHash:       decodeVersionedHash(file.VersionedHash),
+	}, nil
+}
+
+func GetFileInfoByCommit(commit bls12381.G1Affine) (DAFileInfo, error) {
+	var file DAFileInfoStore
+	commitByte48 := commit.Bytes()
+	err := GlobalDataBase.Model(&DAFileInfoStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).First(&file).Error
+
+	return DAFileInfo{
+		Commit:              commit,
+		Size:                file.Size,
+		Expiration:          file.Expiration,
+		ChooseNumber:        file.ChooseNumber,
+		ProvedSuccessNumber: file.ProvedSuccessNumber,
+		BlockNumber:         file.BlockNumber,
+		VersionedHash:       decodeVersionedHash(file.VersionedHash),
+	}, err
+}
+
+func ListFileInfos() ([]DAFileInfo, error) {
+	var files []DAFileInfoStore
+	err := GlobalDataBase.Model(&DAFileInfoStore{}).Order("id").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]DAFileInfo, 0, len(files))
+	for _, file := range files {
+		commit, err := decodeCommitment(file.Commitment)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, DAFileInfo{
+			Commit:              commit,
+			Size:                file.Size,
+			Expiration:          file.Expiration,
+			ChooseNumber:        file.ChooseNumber,
+			ProvedSuccessNumber: file.ProvedSuccessNumber,
+			BlockNumber:         file.BlockNumber,
+			VersionedHash:       decodeVersionedHash(file.VersionedHash),
+		})
+	}
+	return infos, nil
+}
+
+// GetRandomActiveFileInfos picks at most n files unexpired at now randomly
+// among the ones added by the AddFile intents of this node
+func GetRandomActiveFileInfos(now int64, n int) ([]DAFileInfo, error) {
+	var files []DAFileInfoStore
+	intents := GlobalDataBase.Model(&DAAddFileIntentStore{}).Select("commitment")
+	err := GlobalDataBase.Model(&DAFileInfoStore{}).Where("expiration > ? AND commitment IN (?)", now, intents).Order("RANDOM()").Limit(n).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]DAFileInfo, 0, len(files))
+	for _, file := range files {
+		commit, err := decodeCommitment(file.Commitment)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, DAFileInfo{
+			Commit:              commit,
+			Size:                file.Size,
+			Expiration:          file.Expiration,
+			ChooseNumber:        file.ChooseNumber,
+			ProvedSuccessNumber: file.ProvedSuccessNumber,
+			BlockNumber:         file.BlockNumber,
+			VersionedHash:       decodeVersionedHash(file.VersionedHash),
+		})
+	}
+	return infos, nil
+}
+
+// GetFileInfosByBlock lists the files added in the block
+func GetFileInfosByBlock(blockNumber int64) ([]DAFileInfo, error) {
+	var files []DAFileInfoStore
+	err := GlobalDataBase.Model(&DAFileInfoStore{}).Where("block_number = ?", blockNumber).Order("id").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]DAFileInfo, 0, len(files))
+	for _, file := range files {
+		commit, err := decodeCommitment(file.Commitment)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, DAFileInfo{
+			Commit:              commit,
+			Size:                file.Size,
+			Expiration:          file.Expiration,
+			ChooseNumber:        file.ChooseNumber,
+			ProvedSuccessNumber: file.ProvedSuccessNumber,
+			BlockNumber:         file.BlockNumber,
+			VersionedHash:       decodeVersionedHash(file.VersionedHash),
+		})
+	}
+	return infos, nil
+}
+
+// GetFileInfoByVersionedHash finds the file whose commitment has the
+// versioned hash
+func GetFileInfoByVersionedHash(versionedHash [32]byte) (DAFileInfo, error) {
+	var file DAFileInfoStore
+	err := GlobalDataBase.Model(&DAFileInfoStore{}).Where("versioned_hash = ?", hex.EncodeToString(versionedHash[:])).First(&file).Error
+	if err != nil {
+		return DAFileInfo{}, err
+	}
+
+	commit, err := decodeCommitment(file.Commitment)
+	if err != nil {
+		return DAFileInfo{}, err
+	}
+	return DAFileInfo{
+		Commit:              commit,
+		Size:                file.Size,
+		Expiration:          file.Expiration,
+		ChooseNumber:        file.ChooseNumber,
+		ProvedSuccessNumber: file.ProvedSuccessNumber,
+		BlockNumber:         file.BlockNumber,
+		VersionedHash:       versionedHash,
+	}, nil
+}
+
+// fillVersionedHashes computes the versioned hashes of the files indexed
+// before they are recorded
+func fillVersionedHashes(db *gorm.DB) error {
+	var files []DAFileInfoStore
+	err := db.Model(&DAFileInfoStore{}).Where("versioned_hash = ? OR versioned_hash IS NULL", "").Find(&files).Error
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		commitByte48, err := hex.DecodeString(file.Commitment)
+		if err != nil {
+			return err
+		}
+		err = db.Model(&DAFileInfoStore{}).Where("id = ?", file.ID).Update("versioned_hash", versionedHashOf(commitByte48)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeVersionedHash(s string) [32]byte {
+	var versionedHash [32]byte
+	hex.Decode(versionedHash[:], []byte(s))
+	return versionedHash
+}
+
+func versionedHashOf(commitByte48 []byte) string {
+	versionedHash := utils.VersionedHash(commitByte48)
+	return hex.EncodeToString(versionedHash[:])
+}
+
+func decodeCommitment(commitment string) (bls12381.G1Affine, error) {
+	var commit bls12381.G1Affine
+	commitByte48, err := hex.DecodeString(commitment)
+	if err != nil {
+		return commit, err
+	}
+	_, err = commit.SetBytes(commitByte48)
+	return commit, err
+}
+
+// func GetFileByCommit(commit bls12381.G1Affine) ([]byte, error) {
+// 	var file DAFileInfo
+// 	var buf bytes.Buffer
+// 	commitByte48 := commit.Bytes()
+// 	err := GlobalDataBase.Model(&DAFileInfoStore{}).Where("\"commit\" = ?", hex.EncodeToString(commitByte48[:])).First(&file).Error
+// 	if err != nil {
+// 		return nil, err
+// 	}
+
+// 	err = daStore.GetObject(context.TODO(), file.Mid, &buf, gateway.ObjectOptions{})
+// 	if err != nil {
+// 		return nil, err
+// 	}
+
+// 	return buf.Bytes(), nil
+// }
@@ -1,38 +1,199 @@
-package database
-
-import (
-	"encoding/hex"
-
-	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
-)
-
-type DAFileIDInfo struct {
-	// gorm.Model
-	Commit bls12381.G1Affine
-	Mid    string
-}
-
-type DAFileIDInfoStore struct {
-	Commitment string `gorm:"uniqueIndex;column:commitment"`
-	Mid    string `gorm:"uniqueIndex;column:mid"`
-}
-
-func (f *DAFileIDInfo) CreateDAFileIDInfo() error {
-	commitByte48 := f.Commit.Bytes()
-	var info = &DAFileIDInfoStore{
-		Commitment: hex.EncodeToString(commitByte48[:]),
-		Mid:    f.Mid,
-	}
-	return GlobalDataBase.Create(info).Error
-}
-
-func GetFileIDInfoByCommit(commit bls12381.G1Affine) (DAFileIDInfo, error) {
-	var file DAFileIDInfoStore
-	commitByte48 := commit.Bytes()
-	err := GlobalDataBase.Model(&DAFileIDInfoStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).First(&file).Error
-
-	return DAFileIDInfo{
-		Commit: commit,
-		Mid:    file.Mid,
-	}, err
-}
+package database
+
+import (
+	"encoding/hex"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"gorm.io/gorm"
+)
+
+type DAFileIDInfo struct {
+	// gorm.Model
+	Commit bls12381.G1Affine
+	Mid    string
+	// name of the object in da-bucket
+	Name string
+	// namespace of the rollup putting the file, empty if it is not set
+	Namespace string
+	// encoding of the file into field elements
+	Encoding string
+	// the file is the manifest of a large object
+	Manifest   bool
+	Size       int64
+	Expiration int64
+	// the object is deleted from storage after expiration
+	Purged bool
+	// when the file is put, in unix seconds
+	CreatedAt int64
+}
+
+// DAFileIDInfoStore is keyed by the commitment, the same object is shared
+// by the commitments of its data in different encodings
+type DAFileIDInfoStore struct {
+	Commitment string `gorm:"uniqueIndex;column:commitment"`
+	Mid        string `gorm:"index:idx_file_id_mid;column:mid"`
+	Name       string
+	Namespace  string `gorm:"index"`
+	Encoding   string
+	Manifest   bool
+	Size       int64
+	Expiration int64
+	Purged     bool  `gorm:"index"`
+	CreatedAt  int64 `gorm:"index"`
+}
+
+func (f *DAFileIDInfo) CreateDAFileIDInfo() error {
+	commitByte48 := f.Commit.Bytes()
+	var info = &DAFileIDInfoStore{
+		Commitment: hex.EncodeToString(commitByte48[:]),
+		Mid:        f.Mid,
+		Name:       f.Name,
+		Namespace:  f.Namespace,
+		Encoding:   f.Encoding,
+		Manifest:   f.Manifest,
+		Size:       f.Size,
+		Expiration: f.Expiration,
+	}
+	return GlobalDataBase.Create(info).Error
+}
+
+func GetFileIDInfoByCommit(commit bls12381.G1Affine) (DAFileIDInfo, error) {
+	var file DAFileIDInfoStore
+	commitByte48 := commit.Bytes()
+	err := GlobalDataBase.Model(&DAFileIDInfoStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).First(&file).Error
+
+	return DAFileIDInfo{
+		Commit:     commit,
+		Mid:        file.Mid,
+		Name:       file.Name,
+		Namespace:  file.Namespace,
+		Encoding:   file.Encoding,
+		Manifest:   file.Manifest,
+		Size:       file.Size,
+		Expiration: file.Expiration,
+		Purged:     file.Purged,
+		CreatedAt:  file.CreatedAt,
+	}, err
+}
+
+func GetFileIDInfoByMid(mid string) (DAFileIDInfo, error) {
+	var file DAFileIDInfoStore
+	err := GlobalDataBase.Model(&DAFileIDInfoStore{}).Where("mid = ?", mid).First(&file).Error
+	if err != nil {
+		return DAFileIDInfo{}, err
+	}
+	return fileIDStoreToFileID(file)
+}
+
+// UpdateDAFileIDInfo points the commitment to a newly stored object, the
+// commitment has to be indexed
+func (f *DAFileIDInfo) UpdateDAFileIDInfo() error {
+	commitByte48 := f.Commit.Bytes()
+	updates := map[string]interface{}{"mid": f.Mid, "purged": false}
+	if f.Name != "" {
+		updates["name"] = f.Name
+	}
+	if f.Namespace != "" {
+		updates["namespace"] = f.Namespace
+	}
+	if f.Encoding != "" {
+		updates["encoding"] = f.Encoding
+	}
+	if f.Manifest {
+		updates["manifest"] = true
+	}
+	if f.Size != 0 {
+		updates["size"] = f.Size
+	}
+	if f.Expiration != 0 {
+		updates["expiration"] = f.Expiration
+	}
+	tx := GlobalDataBase.Model(&DAFileIDInfoStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).Updates(updates)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (f *DAFileIDInfo) PurgeDAFileIDInfo() error {
+	commitByte48 := f.Commit.Bytes()
+	return GlobalDataBase.Model(&DAFileIDInfoStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).Update("purged", true).Error
+}
+
+// ObjectReferred reports whether the object of mid named name is used by the
+// unpurged files other than the one of commit. The files stored by older
+// versions without the name are counted by mid.
+func ObjectReferred(commit bls12381.G1Affine, mid, name string) (bool, error) {
+	var count int64
+	commitByte48 := commit.Bytes()
+	tx := GlobalDataBase.Model(&DAFileIDInfoStore{}).Where("commitment <> ? AND mid = ? AND purged = ?", hex.EncodeToString(commitByte48[:]), mid, false)
+	if name != "" && name != mid {
+		tx = tx.Where("name = ? OR name = ?", name, "")
+	}
+	err := tx.Count(&count).Error
+	return count > 0, err
+}
+
+// dropUniqueMid drops the unique index on mid of the older versions
+func dropUniqueMid(db *gorm.DB) error {
+	if !db.Migrator().HasIndex(&DAFileIDInfoStore{}, "idx_da_file_id_info_stores_mid") {
+		return nil
+	}
+	return db.Migrator().DropIndex(&DAFileIDInfoStore{}, "idx_da_file_id_info_stores_mid")
+}
+
+func ListFileIDInfos() ([]DAFileIDInfo, error) {
+	var files []DAFileIDInfoStore
+	err := GlobalDataBase.Model(&DAFileIDInfoStore{}).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return fileIDStoresToFileIDs(files)
+}
+
+// GetExpiredFileIDInfos lists the unpurged files expired before deadline. The
+// expiration and size submitted to the contract take precedence over the
+// ones signed in the credential.
+func GetExpiredFileIDInfos(deadline int64, limit int) ([]DAFileIDInfo, error) {
+	var files []DAFileIDInfoStore
+	err := GlobalDataBase.Table("da_file_id_info_stores AS i").
+		Select("i.commitment, i.mid, i.name, i.namespace, i.encoding, i.manifest, COALESCE(f.size, i.size) AS size, COALESCE(f.expiration, i.expiration) AS expiration, i.purged, i.created_at").
+		Joins("LEFT JOIN da_file_info_stores AS f ON f.commitment = i.commitment AND f.deleted_at IS NULL").
+		Where("i.purged = ? AND COALESCE(f.expiration, i.expiration) > 0 AND COALESCE(f.expiration, i.expiration) < ?", false, deadline).
+		Limit(limit).Scan(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return fileIDStoresToFileIDs(files)
+}
+
+func fileIDStoresToFileIDs(files []DAFileIDInfoStore) ([]DAFileIDInfo, error) {
+	infos := make([]DAFileIDInfo, 0, len(files))
+	for _, file := range files {
+		info, err := fileIDStoreToFileID(file)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func fileIDStoreToFileID(file DAFileIDInfoStore) (DAFileIDInfo, error) {
+	commit, err := decodeCommitment(file.Commitment)
+	return DAFileIDInfo{
+		Commit:     commit,
+		Mid:        file.Mid,
+		Name:       file.Name,
+		Namespace:  file.Namespace,
+		Encoding:   file.Encoding,
+		Manifest:   file.Manifest,
+		Size:       file.Size,
+		Expiration: file.Expiration,
+		Purged:     file.Purged,
+		CreatedAt:  file.CreatedAt,
+	}, err
+}
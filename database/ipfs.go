@@ -0,0 +1,66 @@
+package database
+
+import (
+	"gorm.io/gorm/clause"
+)
+
+type DAIpfsObject struct {
+	Cid    string
+	Bucket string
+	Name   string
+	Size   int64
+}
+
+// DAIpfsObjectStore records the objects put into ipfs, which tells them
+// from the other pins of the ipfs node
+type DAIpfsObjectStore struct {
+	Cid    string `gorm:"uniqueIndex:idx_ipfs_object;column:cid"`
+	Bucket string `gorm:"uniqueIndex:idx_ipfs_object;index:idx_ipfs_name"`
+	Name   string `gorm:"uniqueIndex:idx_ipfs_object;index:idx_ipfs_name"`
+	Size   int64
+}
+
+func InitDAIpfsObjectTable() error {
+	return GlobalDataBase.AutoMigrate(&DAIpfsObjectStore{})
+}
+
+func (o *DAIpfsObject) SaveDAIpfsObject() error {
+	var object = &DAIpfsObjectStore{
+		Cid:    o.Cid,
+		Bucket: o.Bucket,
+		Name:   o.Name,
+		Size:   o.Size,
+	}
+	return GlobalDataBase.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cid"}, {Name: "bucket"}, {Name: "name"}},
+		UpdateAll: true,
+	}).Create(object).Error
+}
+
+// ListIpfsObjects lists the objects in bucket by name
+func ListIpfsObjects(bucket, prefix, marker string, limit int) ([]DAIpfsObject, error) {
+	var objects []DAIpfsObjectStore
+	err := GlobalDataBase.Model(&DAIpfsObjectStore{}).
+		Where("bucket = ? AND name > ? AND name LIKE ? ESCAPE '\\'", bucket, marker, escapeLike(prefix)+"%").
+		Order("name").Limit(limit).Find(&objects).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []DAIpfsObject
+	for _, object := range objects {
+		infos = append(infos, DAIpfsObject{
+			Cid:    object.Cid,
+			Bucket: object.Bucket,
+			Name:   object.Name,
+			Size:   object.Size,
+		})
+	}
+	return infos, nil
+}
+
+// DeleteIpfsObjects deletes all the objects of the content cid, which are
+// unpinned together
+func DeleteIpfsObjects(cid string) error {
+	return GlobalDataBase.Where("cid = ?", cid).Delete(&DAIpfsObjectStore{}).Error
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// states of a put job, in the order they are reached
+const (
+	JobReceived         = "received"
+	JobUploaded         = "uploaded"
+	JobCredentialSigned = "credential-signed"
+	JobTxSent           = "tx-sent"
+	JobConfirmed        = "confirmed"
+	JobIndexed          = "indexed"
+	JobFailed           = "failed"
+)
+
+type DAPutJob struct {
+	Job   string
+	State string
+	// commitment of the file, or of the manifest in large mode
+	Commitment string
+	Size       int64
+	Large      bool
+	// where the data is kept until the job is confirmed
+	Path string
+	// metadata of the object in json
+	Meta string
+	// chunks confirmed in large mode
+	Chunks    int
+	Message   string
+	UpdatedAt time.Time
+}
+
+type DAPutJobStore struct {
+	gorm.Model
+	Job        string `gorm:"uniqueIndex;column:job"`
+	State      string `gorm:"index"`
+	Commitment string
+	Size       int64
+	Large      bool
+	Path       string
+	Meta       string
+	Chunks     int
+	Message    string
+}
+
+func InitDAPutJobTable() error {
+	return GlobalDataBase.AutoMigrate(&DAPutJobStore{})
+}
+
+func (j *DAPutJob) CreateDAPutJob() error {
+	var info = &DAPutJobStore{
+		Job:   j.Job,
+		State: j.State,
+		Size:  j.Size,
+		Large: j.Large,
+		Path:  j.Path,
+		Meta:  j.Meta,
+	}
+	return GlobalDataBase.Create(info).Error
+}
+
+func (j *DAPutJob) UpdateDAPutJob() error {
+	return GlobalDataBase.Model(&DAPutJobStore{}).Where("job = ?", j.Job).Updates(map[string]interface{}{
+		"state":      j.State,
+		"commitment": j.Commitment,
+		"chunks":     j.Chunks,
+		"message":    j.Message,
+	}).Error
+}
+
+func GetPutJob(job string) (DAPutJob, error) {
+	var info DAPutJobStore
+	err := GlobalDataBase.Model(&DAPutJobStore{}).Where("job = ?", job).First(&info).Error
+	if err != nil {
+		return DAPutJob{}, err
+	}
+	return putJobStoreToPutJob(info), nil
+}
+
+func GetPutJobsByStates(states ...string) ([]DAPutJob, error) {
+	var infos []DAPutJobStore
+	err := GlobalDataBase.Model(&DAPutJobStore{}).Where("state IN ?", states).Order("id").Find(&infos).Error
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]DAPutJob, 0, len(infos))
+	for _, info := range infos {
+		jobs = append(jobs, putJobStoreToPutJob(info))
+	}
+	return jobs, nil
+}
+
+func putJobStoreToPutJob(info DAPutJobStore) DAPutJob {
+	return DAPutJob{
+		Job:        info.Job,
+		State:      info.State,
+		Commitment: info.Commitment,
+		Size:       info.Size,
+		Large:      info.Large,
+		Path:       info.Path,
+		Meta:       info.Meta,
+		Chunks:     info.Chunks,
+		Message:    info.Message,
+		UpdatedAt:  info.UpdatedAt,
+	}
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"encoding/hex"
+	"errors"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DAManifestStore records the commitments of the manifests of the large
+// objects put through the light node
+type DAManifestStore struct {
+	gorm.Model
+	Commitment string `gorm:"uniqueIndex;column:commitment"`
+}
+
+func InitDAManifestTable() error {
+	return GlobalDataBase.AutoMigrate(&DAManifestStore{})
+}
+
+func SaveManifest(commit bls12381.G1Affine) error {
+	commitByte48 := commit.Bytes()
+	var info = &DAManifestStore{
+		Commitment: hex.EncodeToString(commitByte48[:]),
+	}
+	return GlobalDataBase.Clauses(clause.OnConflict{DoNothing: true}).Create(info).Error
+}
+
+// IsManifest reports whether the file of commit is the manifest of a large
+// object
+func IsManifest(commit bls12381.G1Affine) (bool, error) {
+	var info DAManifestStore
+	commitByte48 := commit.Bytes()
+	err := GlobalDataBase.Model(&DAManifestStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).First(&info).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
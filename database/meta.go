@@ -0,0 +1,66 @@
+package database
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DAFileMeta is the metadata attached to a file by its uploader. It is
+// written once, so the later uploaders of the same data cannot change it.
+type DAFileMeta struct {
+	Commit      bls12381.G1Affine
+	ContentType string
+	Filename    string
+	Tags        map[string]string
+}
+
+type DAFileMetaStore struct {
+	gorm.Model
+	Commitment  string `gorm:"uniqueIndex;column:commitment"`
+	ContentType string
+	Filename    string
+	Tags        string
+}
+
+func InitDAFileMetaTable() error {
+	return GlobalDataBase.AutoMigrate(&DAFileMetaStore{})
+}
+
+func (m *DAFileMeta) SaveDAFileMeta() error {
+	commitByte48 := m.Commit.Bytes()
+	tags, err := json.Marshal(m.Tags)
+	if err != nil {
+		return err
+	}
+	var info = &DAFileMetaStore{
+		Commitment:  hex.EncodeToString(commitByte48[:]),
+		ContentType: m.ContentType,
+		Filename:    m.Filename,
+		Tags:        string(tags),
+	}
+	return GlobalDataBase.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "commitment"}},
+		DoNothing: true,
+	}).Create(info).Error
+}
+
+func GetFileMetaByCommit(commit bls12381.G1Affine) (DAFileMeta, error) {
+	var info DAFileMetaStore
+	commitByte48 := commit.Bytes()
+	err := GlobalDataBase.Model(&DAFileMetaStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).First(&info).Error
+	if err != nil {
+		return DAFileMeta{}, err
+	}
+
+	meta := DAFileMeta{
+		Commit:      commit,
+		ContentType: info.ContentType,
+		Filename:    info.Filename,
+	}
+	err = json.Unmarshal([]byte(info.Tags), &meta.Tags)
+	return meta, err
+}
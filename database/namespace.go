@@ -0,0 +1,117 @@
+package database
+
+import (
+	"encoding/hex"
+	"errors"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DAFileNamespaceStore records the namespaces a file is put in, the same
+// data may be put by the rollups of different namespaces
+type DAFileNamespaceStore struct {
+	Commitment string `gorm:"uniqueIndex:idx_file_namespace;column:commitment"`
+	Namespace  string `gorm:"uniqueIndex:idx_file_namespace;index:idx_namespace_created"`
+	// when the file is put in the namespace, in unix seconds
+	CreatedAt int64 `gorm:"index:idx_namespace_created"`
+}
+
+func InitDAFileNamespaceTable() error {
+	return GlobalDataBase.AutoMigrate(&DAFileNamespaceStore{})
+}
+
+// AddFileNamespace adds the file to the namespace, it is kept in the
+// namespace since it is first added
+func AddFileNamespace(commit bls12381.G1Affine, namespace string) error {
+	commitByte48 := commit.Bytes()
+	var info = &DAFileNamespaceStore{
+		Commitment: hex.EncodeToString(commitByte48[:]),
+		Namespace:  namespace,
+	}
+	return GlobalDataBase.Clauses(clause.OnConflict{DoNothing: true}).Create(info).Error
+}
+
+func GetFileNamespaces(commit bls12381.G1Affine) ([]string, error) {
+	var namespaces []string
+	commitByte48 := commit.Bytes()
+	err := GlobalDataBase.Model(&DAFileNamespaceStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).
+		Order("created_at").Pluck("namespace", &namespaces).Error
+	return namespaces, err
+}
+
+// ListFileIDInfosByNamespace lists the files of the namespace put between
+// from and to in unix seconds, to is not bounded if it is 0. The files put
+// in no namespace are listed if namespace is empty. The CreatedAt of the
+// files is when they are put in the namespace.
+func ListFileIDInfosByNamespace(namespace string, from, to int64, offset, limit int) ([]DAFileIDInfo, error) {
+	if namespace == "" {
+		var files []DAFileIDInfoStore
+		tx := GlobalDataBase.Model(&DAFileIDInfoStore{}).Where("namespace = ? AND created_at >= ?", namespace, from)
+		if to > 0 {
+			tx = tx.Where("created_at < ?", to)
+		}
+		err := tx.Order("created_at").Order("commitment").Offset(offset).Limit(limit).Find(&files).Error
+		if err != nil {
+			return nil, err
+		}
+		return fileIDStoresToFileIDs(files)
+	}
+
+	var members []DAFileNamespaceStore
+	tx := GlobalDataBase.Model(&DAFileNamespaceStore{}).Where("namespace = ? AND created_at >= ?", namespace, from)
+	if to > 0 {
+		tx = tx.Where("created_at < ?", to)
+	}
+	err := tx.Order("created_at").Order("commitment").Offset(offset).Limit(limit).Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]DAFileIDInfo, 0, len(members))
+	for _, member := range members {
+		var file DAFileIDInfoStore
+		err := GlobalDataBase.Model(&DAFileIDInfoStore{}).Where("commitment = ?", member.Commitment).First(&file).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info, err := fileIDStoreToFileID(file)
+		if err != nil {
+			return nil, err
+		}
+		info.CreatedAt = member.CreatedAt
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// fillFileNamespaces adds the files to the namespaces they are first put
+// in, which were kept in DAFileIDInfoStore only
+func fillFileNamespaces(db *gorm.DB) error {
+	var count int64
+	err := db.Model(&DAFileNamespaceStore{}).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+
+	var files []DAFileIDInfoStore
+	err = db.Model(&DAFileIDInfoStore{}).Where("namespace <> ?", "").Find(&files).Error
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&DAFileNamespaceStore{
+			Commitment: file.Commitment,
+			Namespace:  file.Namespace,
+			CreatedAt:  file.CreatedAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
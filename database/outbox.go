@@ -0,0 +1,153 @@
+package database
+
+import (
+	"encoding/hex"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// states of an AddFile intent
+const (
+	// the first AddFile is in flight, it is retried only after its timeout
+	IntentSending = "sending"
+	IntentPending = "pending"
+	IntentDone    = "done"
+	IntentFailed  = "failed"
+)
+
+// DAAddFileIntent is a file stored in the store node which is going to be
+// added to the contract with the credential signed by the store node
+type DAAddFileIntent struct {
+	Commit    bls12381.G1Affine
+	Size      int64
+	Start     int64
+	End       int64
+	Signature []byte
+	State     string
+	Attempts  int
+	NextTry   int64
+	Message   string
+}
+
+type DAAddFileIntentStore struct {
+	gorm.Model
+	Commitment string `gorm:"uniqueIndex;column:commitment"`
+	Size       int64
+	Start      int64
+	End        int64
+	Signature  string
+	State      string `gorm:"index"`
+	Attempts   int
+	NextTry    int64
+	Message    string
+}
+
+func InitDAAddFileIntentTable() error {
+	return GlobalDataBase.AutoMigrate(&DAAddFileIntentStore{})
+}
+
+// SaveDAAddFileIntent records an intent whose first AddFile is going to be
+// sent, which is retried after NextTry if it is not settled. The intent of
+// the same commitment is replaced since the file is stored again.
+func (i *DAAddFileIntent) SaveDAAddFileIntent() error {
+	commitByte48 := i.Commit.Bytes()
+	var info = &DAAddFileIntentStore{
+		Commitment: hex.EncodeToString(commitByte48[:]),
+		Size:       i.Size,
+		Start:      i.Start,
+		End:        i.End,
+		Signature:  hex.EncodeToString(i.Signature),
+		State:      IntentSending,
+		NextTry:    i.NextTry,
+	}
+	return GlobalDataBase.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "commitment"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "size", "start", "end", "signature", "state", "attempts", "next_try", "message"}),
+	}).Create(info).Error
+}
+
+// RecordAddFileAttempt records a failed attempt, the intent is pending and
+// retried after nextTry
+func RecordAddFileAttempt(commit bls12381.G1Affine, message string, nextTry int64) error {
+	commitByte48 := commit.Bytes()
+	return GlobalDataBase.Model(&DAAddFileIntentStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).Updates(map[string]interface{}{
+		"state":    IntentPending,
+		"attempts": gorm.Expr("attempts + 1"),
+		"next_try": nextTry,
+		"message":  message,
+	}).Error
+}
+
+func SetAddFileIntentState(commit bls12381.G1Affine, state, message string) error {
+	commitByte48 := commit.Bytes()
+	return GlobalDataBase.Model(&DAAddFileIntentStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).Updates(map[string]interface{}{
+		"state":   state,
+		"message": message,
+	}).Error
+}
+
+func GetAddFileIntent(commit bls12381.G1Affine) (DAAddFileIntent, error) {
+	var info DAAddFileIntentStore
+	commitByte48 := commit.Bytes()
+	err := GlobalDataBase.Model(&DAAddFileIntentStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).First(&info).Error
+	if err != nil {
+		return DAAddFileIntent{}, err
+	}
+	return intentStoreToIntent(info)
+}
+
+// GetDueAddFileIntents lists the intents to retry at now, which are the
+// pending ones and the ones whose first AddFile timed out
+func GetDueAddFileIntents(now int64, limit int) ([]DAAddFileIntent, error) {
+	var infos []DAAddFileIntentStore
+	err := GlobalDataBase.Model(&DAAddFileIntentStore{}).Where("state IN ? AND next_try <= ?", []string{IntentPending, IntentSending}, now).Order("next_try").Limit(limit).Find(&infos).Error
+	if err != nil {
+		return nil, err
+	}
+	return intentStoresToIntents(infos)
+}
+
+func GetAddFileIntentsByState(state string, offset, limit int) ([]DAAddFileIntent, error) {
+	var infos []DAAddFileIntentStore
+	err := GlobalDataBase.Model(&DAAddFileIntentStore{}).Where("state = ?", state).Order("id").Offset(offset).Limit(limit).Find(&infos).Error
+	if err != nil {
+		return nil, err
+	}
+	return intentStoresToIntents(infos)
+}
+
+func intentStoresToIntents(infos []DAAddFileIntentStore) ([]DAAddFileIntent, error) {
+	intents := make([]DAAddFileIntent, 0, len(infos))
+	for _, info := range infos {
+		intent, err := intentStoreToIntent(info)
+		if err != nil {
+			return nil, err
+		}
+		intents = append(intents, intent)
+	}
+	return intents, nil
+}
+
+func intentStoreToIntent(info DAAddFileIntentStore) (DAAddFileIntent, error) {
+	commit, err := decodeCommitment(info.Commitment)
+	if err != nil {
+		return DAAddFileIntent{}, err
+	}
+	signature, err := hex.DecodeString(info.Signature)
+	if err != nil {
+		return DAAddFileIntent{}, err
+	}
+	return DAAddFileIntent{
+		Commit:    commit,
+		Size:      info.Size,
+		Start:     info.Start,
+		End:       info.End,
+		Signature: signature,
+		State:     info.State,
+		Attempts:  info.Attempts,
+		NextTry:   info.NextTry,
+		Message:   info.Message,
+	}, nil
+}
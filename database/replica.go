@@ -0,0 +1,127 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DAReplicaInfo struct {
+	Mid     string
+	Backend string
+	Bucket  string
+	Name    string
+	Cid     string
+	Size    int64
+	Missing bool
+	// the repair of the missing replica is retried after NextTry
+	Attempts int
+	NextTry  int64
+}
+
+// DAReplicaInfoStore records where a replica of the object mid is kept
+// in each backend of a replicated gateway
+type DAReplicaInfoStore struct {
+	Mid      string `gorm:"uniqueIndex:idx_replica;column:mid"`
+	Backend  string `gorm:"uniqueIndex:idx_replica;column:backend"`
+	Bucket   string `gorm:"index:idx_replica_name"`
+	Name     string `gorm:"index:idx_replica_name"`
+	Cid      string
+	Size     int64
+	Missing  bool `gorm:"index"`
+	Attempts int
+	NextTry  int64
+}
+
+func InitDAReplicaInfoTable() error {
+	return GlobalDataBase.AutoMigrate(&DAReplicaInfoStore{})
+}
+
+func (r *DAReplicaInfo) SaveDAReplicaInfo() error {
+	var info = &DAReplicaInfoStore{
+		Mid:      r.Mid,
+		Backend:  r.Backend,
+		Bucket:   r.Bucket,
+		Name:     r.Name,
+		Cid:      r.Cid,
+		Size:     r.Size,
+		Missing:  r.Missing,
+		Attempts: r.Attempts,
+		NextTry:  r.NextTry,
+	}
+	return GlobalDataBase.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "mid"}, {Name: "backend"}},
+		UpdateAll: true,
+	}).Create(info).Error
+}
+
+func GetReplicaInfosByMid(mid string) ([]DAReplicaInfo, error) {
+	var replicas []DAReplicaInfoStore
+	err := GlobalDataBase.Model(&DAReplicaInfoStore{}).Where("mid = ?", mid).Find(&replicas).Error
+	if err != nil {
+		return nil, err
+	}
+	return replicaStoresToReplicas(replicas), nil
+}
+
+func GetReplicaInfosByName(bucket, name string) ([]DAReplicaInfo, error) {
+	var replicas []DAReplicaInfoStore
+	err := GlobalDataBase.Model(&DAReplicaInfoStore{}).Where("bucket = ? AND name = ?", bucket, name).Find(&replicas).Error
+	if err != nil {
+		return nil, err
+	}
+	return replicaStoresToReplicas(replicas), nil
+}
+
+// GetMissingReplicaInfos returns the missing replicas due to be repaired at
+// now, the ones waited for longest first
+func GetMissingReplicaInfos(now int64, limit int) ([]DAReplicaInfo, error) {
+	var replicas []DAReplicaInfoStore
+	err := GlobalDataBase.Model(&DAReplicaInfoStore{}).Where("missing = ? AND next_try <= ?", true, now).Order("next_try").Limit(limit).Find(&replicas).Error
+	if err != nil {
+		return nil, err
+	}
+	return replicaStoresToReplicas(replicas), nil
+}
+
+// RecordReplicaRepairAttempt records a failed repair of the replica, which
+// is retried after nextTry
+func RecordReplicaRepairAttempt(mid, backend string, nextTry int64) error {
+	return GlobalDataBase.Model(&DAReplicaInfoStore{}).Where("mid = ? AND backend = ?", mid, backend).Updates(map[string]interface{}{
+		"attempts": gorm.Expr("attempts + 1"),
+		"next_try": nextTry,
+	}).Error
+}
+
+// ListReplicaInfos lists one replica of each object in bucket by name
+func ListReplicaInfos(bucket, prefix, marker string, limit int) ([]DAReplicaInfo, error) {
+	var replicas []DAReplicaInfoStore
+	err := GlobalDataBase.Model(&DAReplicaInfoStore{}).
+		Where("bucket = ? AND name > ? AND name LIKE ? ESCAPE '\\'", bucket, marker, escapeLike(prefix)+"%").
+		Group("name").Order("name").Limit(limit).Find(&replicas).Error
+	if err != nil {
+		return nil, err
+	}
+	return replicaStoresToReplicas(replicas), nil
+}
+
+func DeleteReplicaInfo(mid, backend string) error {
+	return GlobalDataBase.Where("mid = ? AND backend = ?", mid, backend).Delete(&DAReplicaInfoStore{}).Error
+}
+
+func replicaStoresToReplicas(replicas []DAReplicaInfoStore) []DAReplicaInfo {
+	var infos []DAReplicaInfo
+	for _, replica := range replicas {
+		infos = append(infos, DAReplicaInfo{
+			Mid:      replica.Mid,
+			Backend:  replica.Backend,
+			Bucket:   replica.Bucket,
+			Name:     replica.Name,
+			Cid:      replica.Cid,
+			Size:     replica.Size,
+			Missing:  replica.Missing,
+			Attempts: replica.Attempts,
+			NextTry:  replica.NextTry,
+		})
+	}
+	return infos
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"encoding/hex"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DASampleInfo is the result of sampling the availability of a file
+type DASampleInfo struct {
+	Commit              bls12381.G1Affine
+	Samples             int64
+	Failures            int64
+	ConsecutiveFailures int64
+	LastSampled         int64
+	LastError           string
+}
+
+type DASampleInfoStore struct {
+	gorm.Model
+	Commitment          string `gorm:"uniqueIndex;column:commitment"`
+	Samples             int64
+	Failures            int64
+	ConsecutiveFailures int64 `gorm:"index"`
+	LastSampled         int64
+	LastError           string
+}
+
+// Score is the ratio of the samples succeeded
+func (s *DASampleInfo) Score() float64 {
+	if s.Samples == 0 {
+		return 0
+	}
+	return float64(s.Samples-s.Failures) / float64(s.Samples)
+}
+
+func InitDASampleInfoTable() error {
+	return GlobalDataBase.AutoMigrate(&DASampleInfoStore{})
+}
+
+// RecordSample counts a sample of the file at the time, message is the
+// error of a failed sample
+func RecordSample(commit bls12381.G1Affine, ok bool, message string, at int64) error {
+	commitByte48 := commit.Bytes()
+	var info = &DASampleInfoStore{
+		Commitment:  hex.EncodeToString(commitByte48[:]),
+		Samples:     1,
+		LastSampled: at,
+		LastError:   message,
+	}
+	updates := map[string]interface{}{
+		"updated_at":   gorm.Expr("excluded.updated_at"),
+		"samples":      gorm.Expr("samples + 1"),
+		"last_sampled": at,
+		"last_error":   message,
+	}
+	if ok {
+		updates["consecutive_failures"] = 0
+	} else {
+		info.Failures = 1
+		info.ConsecutiveFailures = 1
+		updates["failures"] = gorm.Expr("failures + 1")
+		updates["consecutive_failures"] = gorm.Expr("consecutive_failures + 1")
+	}
+
+	return GlobalDataBase.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "commitment"}},
+		DoUpdates: clause.Assignments(updates),
+	}).Create(info).Error
+}
+
+func GetSampleInfo(commit bls12381.G1Affine) (DASampleInfo, error) {
+	var info DASampleInfoStore
+	commitByte48 := commit.Bytes()
+	err := GlobalDataBase.Model(&DASampleInfoStore{}).Where("commitment = ?", hex.EncodeToString(commitByte48[:])).First(&info).Error
+	if err != nil {
+		return DASampleInfo{}, err
+	}
+	return sampleStoreToSample(info)
+}
+
+// ListFailingSamples lists the files whose last samples failed
+func ListFailingSamples(offset, limit int) ([]DASampleInfo, error) {
+	var infos []DASampleInfoStore
+	err := GlobalDataBase.Model(&DASampleInfoStore{}).Where("consecutive_failures > 0").Order("consecutive_failures DESC").Offset(offset).Limit(limit).Find(&infos).Error
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]DASampleInfo, 0, len(infos))
+	for _, info := range infos {
+		sample, err := sampleStoreToSample(info)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+func sampleStoreToSample(info DASampleInfoStore) (DASampleInfo, error) {
+	commit, err := decodeCommitment(info.Commitment)
+	if err != nil {
+		return DASampleInfo{}, err
+	}
+	return DASampleInfo{
+		Commit:              commit,
+		Samples:             info.Samples,
+		Failures:            info.Failures,
+		ConsecutiveFailures: info.ConsecutiveFailures,
+		LastSampled:         info.LastSampled,
+		LastError:           info.LastError,
+	}, nil
+}
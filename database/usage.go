@@ -0,0 +1,90 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DAUsageStore counts the requests and bytes of an account on a route in
+// the bucket of time beginning at Bucket
+type DAUsageStore struct {
+	gorm.Model
+	Account  string `gorm:"uniqueIndex:usage_bucket"`
+	Route    string `gorm:"uniqueIndex:usage_bucket"`
+	Bucket   int64  `gorm:"uniqueIndex:usage_bucket;index"`
+	Requests int64
+	Bytes    int64
+}
+
+type DAUsage struct {
+	Requests int64
+	Bytes    int64
+}
+
+func InitDAUsageTable() error {
+	return GlobalDataBase.AutoMigrate(&DAUsageStore{})
+}
+
+// AddUsage adds the requests and bytes to the bucket of the account
+func AddUsage(account, route string, bucket int64, requests, bytes int64) error {
+	return addUsage(GlobalDataBase, account, route, bucket, requests, bytes)
+}
+
+// AddUsageWithin adds the requests and bytes to the bucket of the account
+// unless the usage in the buckets from since would exceed limit, whose zero
+// fields mean no limit. The usage before the addition is returned.
+func AddUsageWithin(account, route string, bucket, since int64, requests, bytes int64, limit DAUsage) (DAUsage, bool, error) {
+	var usage DAUsage
+	added := false
+	err := GlobalDataBase.Transaction(func(tx *gorm.DB) error {
+		err := sumUsage(tx, account, route, since).Scan(&usage).Error
+		if err != nil {
+			return err
+		}
+		if limit.Requests > 0 && usage.Requests+requests > limit.Requests {
+			return nil
+		}
+		if limit.Bytes > 0 && usage.Bytes+bytes > limit.Bytes {
+			return nil
+		}
+		added = true
+		return addUsage(tx, account, route, bucket, requests, bytes)
+	})
+	return usage, added, err
+}
+
+func addUsage(db *gorm.DB, account, route string, bucket int64, requests, bytes int64) error {
+	var info = &DAUsageStore{
+		Account:  account,
+		Route:    route,
+		Bucket:   bucket,
+		Requests: requests,
+		Bytes:    bytes,
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "account"}, {Name: "route"}, {Name: "bucket"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"updated_at": gorm.Expr("excluded.updated_at"),
+			"requests":   gorm.Expr("requests + excluded.requests"),
+			"bytes":      gorm.Expr("bytes + excluded.bytes"),
+		}),
+	}).Create(info).Error
+}
+
+// GetUsage sums the usage of the account on the route in the buckets from
+// since
+func GetUsage(account, route string, since int64) (DAUsage, error) {
+	var usage DAUsage
+	err := sumUsage(GlobalDataBase, account, route, since).Scan(&usage).Error
+	return usage, err
+}
+
+func sumUsage(db *gorm.DB, account, route string, since int64) *gorm.DB {
+	return db.Model(&DAUsageStore{}).Select("COALESCE(SUM(requests), 0) AS requests, COALESCE(SUM(bytes), 0) AS bytes").
+		Where("account = ? AND route = ? AND bucket >= ?", account, route, since)
+}
+
+// DeleteUsageBefore removes the buckets before the deadline
+func DeleteUsageBefore(deadline int64) error {
+	return GlobalDataBase.Unscoped().Where("bucket < ?", deadline).Delete(&DAUsageStore{}).Error
+}
@@ -1,15 +1,43 @@
-package gateway
-
-import (
-	"context"
-	"io"
-)
-
-type IGateway interface {
-	GetStoreType(context.Context) StorageType
-	PutObject(context.Context, string, string, io.Reader, ObjectOptions) (ObjectInfo, error)
-	GetObject(context.Context, string, io.Writer, ObjectOptions) error
-	DeleteObject(context.Context, string, string) error
-	// ListObjects(context.Context, string) ([]ObjectInfo, error)
-	// GetObjectInfo(context.Context, string) (ObjectInfo, error)
-}
+package gateway
+
+import (
+	"context"
+	"io"
+
+	"github.com/memoio/meeda-node/logs"
+)
+
+type IGateway interface {
+	GetStoreType(context.Context) StorageType
+	PutObject(context.Context, string, string, io.Reader, ObjectOptions) (ObjectInfo, error)
+	GetObject(context.Context, string, io.Writer, ObjectOptions) error
+	DeleteObject(context.Context, string, string) error
+	ListObjects(context.Context, string, ListObjectsOptions) (ListObjectsInfo, error)
+	// GetObjectInfo(context.Context, string) (ObjectInfo, error)
+}
+
+// IHealth is implemented by gateways which can probe their backend
+type IHealth interface {
+	Health(context.Context) error
+}
+
+// OpenGateway connects to the backend selected by cfg.Type
+func OpenGateway(cfg Config) (IGateway, error) {
+	switch cfg.Type {
+	case MEFS:
+		if cfg.Api == "" {
+			return NewGateway()
+		}
+		return CreateGateWay(cfg.Api, cfg.Token)
+	case IPFS:
+		return NewIpfsGateway(cfg.Api)
+	case QINIU, S3:
+		return NewS3Gateway(cfg.Type, cfg.Api, cfg.AccessKey, cfg.SecretKey, cfg.Region)
+	case LOCAL:
+		return NewLocalGateway(cfg.Path)
+	case REPLICA:
+		return NewReplicatedGateway(cfg.Replicas, cfg.Quorum)
+	default:
+		return nil, logs.StorageNotSupport{}
+	}
+}
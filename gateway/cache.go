@@ -0,0 +1,416 @@
+package gateway
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/memoio/meeda-node/logs"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+)
+
+var _ IGateway = (*Cache)(nil)
+
+// Verifier checks the content of the object mid, e.g. by recomputing its
+// commitment. It is called before an object read from the backend is
+// cached, and when a cached object is loaded from disk for the first time.
+type Verifier func(mid string, data []byte) error
+
+// Cache keeps the recently read objects on the local disk, keyed by the mid
+// returned from PutObject, and evicts the least recently used ones once
+// the cached bytes exceed the capacity. Only whole objects are cached,
+// ranges are cut from the cached copy. The objects put through the cache
+// are evicted by their names on DeleteObject, the others by Evict.
+//
+// layout:
+//
+//	<root>/blobs/<mid>    cached object
+//	<root>/tmp            staging area for atomic writes
+type Cache struct {
+	IGateway
+	root     string
+	capacity int64
+	verify   Verifier
+
+	lk      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	// mids of the cached objects by bucket and name
+	names map[string]string
+	size  int64
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+	corrupted atomic.Int64
+}
+
+type cacheEntry struct {
+	mid  string
+	size int64
+	// sha256 of the content once it is verified, entries found on disk
+	// at startup are verified when they are first read
+	sum      [32]byte
+	verified bool
+	names    []string
+}
+
+type CacheStats struct {
+	Capacity  int64 `json:"capacity"`
+	Size      int64 `json:"size"`
+	Entries   int   `json:"entries"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Corrupted int64 `json:"corrupted"`
+}
+
+func NewCache(backend IGateway, path string, capacity int64) (*Cache, error) {
+	root, err := homedir.Expand(path)
+	if err != nil || root == "" || capacity <= 0 {
+		lerr := logs.StorageError{Storage: "cache", Message: "illegal cache path or capacity"}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	for _, dir := range []string{"blobs", "tmp"} {
+		err = os.MkdirAll(filepath.Join(root, dir), 0755)
+		if err != nil {
+			lerr := logs.StorageError{Storage: "cache", Message: err.Error()}
+			logger.Error(lerr)
+			return nil, lerr
+		}
+	}
+
+	c := &Cache{
+		IGateway: backend,
+		root:     root,
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		names:    make(map[string]string),
+	}
+
+	err = c.load()
+	if err != nil {
+		lerr := logs.StorageError{Storage: "cache", Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	return c, nil
+}
+
+// SetVerifier sets the integrity check of the objects loaded from disk
+func (c *Cache) SetVerifier(verify Verifier) {
+	c.verify = verify
+}
+
+// Unwrap returns the gateway behind the cache
+func (c *Cache) Unwrap() IGateway {
+	return c.IGateway
+}
+
+func (c *Cache) Health(ctx context.Context) error {
+	if h, ok := c.IGateway.(IHealth); ok {
+		return h.Health(ctx)
+	}
+	return nil
+}
+
+// PutObject writes the object into the backend and caches it, since a new
+// object is likely to be read soon
+func (c *Cache) PutObject(ctx context.Context, bucket, object string, r io.Reader, opts ObjectOptions) (ObjectInfo, error) {
+	var buf bytes.Buffer
+	objInfo, err := c.IGateway.PutObject(ctx, bucket, object, io.TeeReader(r, &buf), opts)
+	if err != nil {
+		return objInfo, err
+	}
+
+	if objInfo.Cid != "" && int64(buf.Len()) <= c.capacity {
+		c.add(objInfo.Cid, bucket+"/"+object, buf.Bytes())
+	}
+	return objInfo, nil
+}
+
+func (c *Cache) GetObject(ctx context.Context, objectName string, writer io.Writer, opts ObjectOptions) error {
+	data, ok := c.get(objectName)
+	if ok {
+		c.hits.Add(1)
+		start, length, err := opts.Range(int64(len(data)))
+		if err != nil {
+			return logs.StorageError{Storage: "cache", Message: err.Error()}
+		}
+		_, err = writer.Write(data[start : start+length])
+		if err != nil {
+			return logs.StorageError{Storage: "cache", Message: err.Error()}
+		}
+		return nil
+	}
+	c.misses.Add(1)
+
+	// a range read of an uncached object does not fetch the whole object
+	if opts.Offset != 0 || opts.Length != 0 {
+		return c.IGateway.GetObject(ctx, objectName, writer, opts)
+	}
+
+	var buf bytes.Buffer
+	err := c.IGateway.GetObject(ctx, objectName, &buf, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Size > 0 && int64(buf.Len()) != opts.Size {
+		return logs.StorageError{Storage: "cache", Message: xerrors.Errorf("got %d bytes of %s, expected %d", buf.Len(), objectName, opts.Size).Error()}
+	}
+
+	if int64(buf.Len()) <= c.capacity {
+		err = nil
+		if c.verify != nil {
+			err = c.verify(objectName, buf.Bytes())
+		}
+		if err != nil {
+			logger.Errorf("not cache %s: %s", objectName, err)
+		} else {
+			c.add(objectName, "", buf.Bytes())
+		}
+	}
+
+	_, err = writer.Write(buf.Bytes())
+	if err != nil {
+		return logs.StorageError{Storage: "cache", Message: err.Error()}
+	}
+	return nil
+}
+
+// DeleteObject deletes the object from the backend and evicts it, object
+// is the mid itself for the backends addressing objects by content
+func (c *Cache) DeleteObject(ctx context.Context, bucket, object string) error {
+	err := c.IGateway.DeleteObject(ctx, bucket, object)
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	mid, ok := c.names[bucket+"/"+object]
+	if !ok {
+		mid = object
+	}
+	if elem, ok := c.entries[mid]; ok {
+		c.remove(elem)
+	}
+	return err
+}
+
+// Evict drops the cached object mid, it should be called once the object
+// is deleted from the backend
+func (c *Cache) Evict(mid string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if elem, ok := c.entries[mid]; ok {
+		c.remove(elem)
+	}
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	return CacheStats{
+		Capacity:  c.capacity,
+		Size:      c.size,
+		Entries:   len(c.entries),
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Corrupted: c.corrupted.Load(),
+	}
+}
+
+func (c *Cache) get(mid string) ([]byte, bool) {
+	c.lk.Lock()
+	elem, ok := c.entries[mid]
+	if !ok {
+		c.lk.Unlock()
+		return nil, false
+	}
+	entry := *elem.Value.(*cacheEntry)
+	c.lru.MoveToFront(elem)
+	c.lk.Unlock()
+
+	// read and verify without holding the lock
+	data, err := os.ReadFile(c.blobPath(mid))
+	if err == nil && int64(len(data)) != entry.size {
+		err = xerrors.Errorf("cached %d bytes, expected %d", len(data), entry.size)
+	}
+	if err == nil {
+		if entry.verified {
+			if sha256.Sum256(data) != entry.sum {
+				err = xerrors.New("checksum mismatch")
+			}
+		} else if c.verify != nil {
+			err = c.verify(mid, data)
+		}
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	elem, ok = c.entries[mid]
+	if err != nil {
+		// the object may be evicted while reading
+		if !os.IsNotExist(err) {
+			logger.Errorf("drop cached %s: %s", mid, err)
+			c.corrupted.Add(1)
+		}
+		if ok {
+			c.remove(elem)
+		}
+		return nil, false
+	}
+
+	if ok && !entry.verified {
+		e := elem.Value.(*cacheEntry)
+		e.sum = sha256.Sum256(data)
+		e.verified = true
+	}
+	return data, true
+}
+
+// add caches data as the object mid, whose name is empty if it is unknown
+func (c *Cache) add(mid, name string, data []byte) {
+	c.lk.Lock()
+	elem, ok := c.entries[mid]
+	if ok {
+		c.addName(elem, name)
+	}
+	c.lk.Unlock()
+	if ok {
+		return
+	}
+
+	// the file is written without holding the lock, the concurrent adds of
+	// the same object write the same content
+	err := writeFileAtomic(filepath.Join(c.root, "tmp"), c.blobPath(mid), data)
+	if err != nil {
+		logger.Errorf("cache %s: %s", mid, err)
+		return
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	elem, ok = c.entries[mid]
+	if ok {
+		c.addName(elem, name)
+		return
+	}
+	elem = c.lru.PushFront(&cacheEntry{
+		mid:      mid,
+		size:     int64(len(data)),
+		sum:      sha256.Sum256(data),
+		verified: true,
+	})
+	c.entries[mid] = elem
+	c.addName(elem, name)
+	c.size += int64(len(data))
+
+	for c.size > c.capacity {
+		c.remove(c.lru.Back())
+		c.evictions.Add(1)
+	}
+}
+
+func (c *Cache) addName(elem *list.Element, name string) {
+	if name == "" {
+		return
+	}
+	entry := elem.Value.(*cacheEntry)
+	if c.names[name] != entry.mid {
+		c.names[name] = entry.mid
+		entry.names = append(entry.names, name)
+	}
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.mid)
+	for _, name := range entry.names {
+		if c.names[name] == entry.mid {
+			delete(c.names, name)
+		}
+	}
+	c.size -= entry.size
+
+	err := os.Remove(c.blobPath(entry.mid))
+	if err != nil && !os.IsNotExist(err) {
+		logger.Error(err)
+	}
+}
+
+// load indexes the objects cached by last run, the most recently modified
+// ones are taken as the most recently used
+func (c *Cache) load() error {
+	entries, err := os.ReadDir(filepath.Join(c.root, "blobs"))
+	if err != nil {
+		return err
+	}
+
+	type cached struct {
+		mid  string
+		info os.FileInfo
+	}
+	var files []cached
+	for _, entry := range entries {
+		mid, err := url.PathUnescape(entry.Name())
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, cached{mid: mid, info: info})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].info.ModTime().After(files[j].info.ModTime())
+	})
+
+	for _, file := range files {
+		c.entries[file.mid] = c.lru.PushBack(&cacheEntry{
+			mid:  file.mid,
+			size: file.info.Size(),
+		})
+		c.size += file.info.Size()
+	}
+	for c.size > c.capacity {
+		c.remove(c.lru.Back())
+	}
+
+	logger.Infof("load %d cached objects, %d bytes", len(c.entries), c.size)
+	return nil
+}
+
+func (c *Cache) blobPath(mid string) string {
+	return filepath.Join(c.root, "blobs", url.PathEscape(mid))
+}
+
+// Unwrap returns the gateway behind the wrappers of gw
+func Unwrap(gw IGateway) IGateway {
+	for {
+		w, ok := gw.(interface{ Unwrap() IGateway })
+		if !ok {
+			return gw
+		}
+		gw = w.Unwrap()
+	}
+}
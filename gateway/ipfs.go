@@ -0,0 +1,277 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/logs"
+	"golang.org/x/xerrors"
+)
+
+var _ IGateway = (*Ipfs)(nil)
+
+// Ipfs stores blobs through the kubo http rpc api. ipfs has no buckets, so
+// objects are addressed by the cid returned from PutObject everywhere, and
+// their names are kept in the DAIpfsObjectStore table.
+type Ipfs struct {
+	st     StorageType
+	api    string
+	client *http.Client
+}
+
+type ipfsAddResult struct {
+	Name string
+	Hash string
+	Size string
+}
+
+type ipfsPinLsResult struct {
+	Keys map[string]struct {
+		Type string
+	}
+}
+
+type ipfsError struct {
+	Message string
+	Code    int
+	Type    string
+}
+
+func NewIpfsGateway(api string) (IGateway, error) {
+	if api == "" {
+		api = "http://127.0.0.1:5001"
+	}
+	if !strings.HasPrefix(api, "http://") && !strings.HasPrefix(api, "https://") {
+		api = "http://" + api
+	}
+
+	i := &Ipfs{
+		st:     IPFS,
+		api:    strings.TrimSuffix(api, "/"),
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+
+	res, err := i.call(context.Background(), "version", nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	res.Close()
+
+	return i, nil
+}
+
+func (i *Ipfs) GetStoreType(ctx context.Context) StorageType {
+	return i.st
+}
+
+// PutObject adds and pins the content, the returned Cid is the ipfs cid
+func (i *Ipfs) PutObject(ctx context.Context, bucket, object string, r io.Reader, opts ObjectOptions) (objInfo ObjectInfo, err error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	counter := &countWriter{}
+	// counter is read after the goroutine writing the body is done
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		part, err := mw.CreateFormFile("file", object)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		_, err = io.Copy(io.MultiWriter(part, counter), r)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(mw.Close())
+	}()
+
+	params := url.Values{}
+	params.Set("pin", "true")
+	params.Set("cid-version", "1")
+	res, err := i.call(ctx, "add", params, pr, mw.FormDataContentType())
+	if err != nil {
+		pr.CloseWithError(err)
+		<-done
+		return objInfo, err
+	}
+	defer res.Close()
+
+	var added ipfsAddResult
+	err = json.NewDecoder(res).Decode(&added)
+	if err != nil {
+		pr.CloseWithError(err)
+		<-done
+		return objInfo, i.storageError(err)
+	}
+	<-done
+
+	stored := database.DAIpfsObject{
+		Cid:    added.Hash,
+		Bucket: bucket,
+		Name:   object,
+		Size:   counter.n,
+	}
+	err = stored.SaveDAIpfsObject()
+	if err != nil {
+		return objInfo, i.storageError(err)
+	}
+
+	return ObjectInfo{
+		SType:       i.st,
+		Bucket:      bucket,
+		Name:        object,
+		Size:        counter.n,
+		Cid:         added.Hash,
+		ModTime:     time.Now(),
+		UserDefined: opts.UserDefined,
+	}, nil
+}
+
+func (i *Ipfs) GetObject(ctx context.Context, objectName string, writer io.Writer, opts ObjectOptions) error {
+	params := url.Values{}
+	params.Set("arg", objectName)
+	if opts.Offset < 0 || opts.Length < 0 {
+		return i.storageError(xerrors.Errorf("illegal range %d+%d", opts.Offset, opts.Length))
+	}
+	if opts.Offset > 0 {
+		params.Set("offset", strconv.FormatInt(opts.Offset, 10))
+	}
+	if opts.Length > 0 {
+		params.Set("length", strconv.FormatInt(opts.Length, 10))
+	}
+	res, err := i.call(ctx, "cat", params, nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	_, err = io.Copy(writer, res)
+	if err != nil {
+		return i.storageError(err)
+	}
+	return nil
+}
+
+// ListObjects lists the objects put into bucket which are still pinned, the
+// other pins of the ipfs node are left out
+func (i *Ipfs) ListObjects(ctx context.Context, bucket string, opts ListObjectsOptions) (ListObjectsInfo, error) {
+	var loi ListObjectsInfo
+	maxKeys := opts.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	objects, err := database.ListIpfsObjects(bucket, opts.Prefix, opts.Marker, maxKeys+1)
+	if err != nil {
+		return loi, i.storageError(err)
+	}
+
+	params := url.Values{}
+	params.Set("type", "recursive")
+	res, err := i.call(ctx, "pin/ls", params, nil, "")
+	if err != nil {
+		return loi, err
+	}
+	defer res.Close()
+
+	var pins ipfsPinLsResult
+	err = json.NewDecoder(res).Decode(&pins)
+	if err != nil {
+		return loi, i.storageError(err)
+	}
+
+	for n, object := range objects {
+		if n == maxKeys {
+			loi.IsTruncated = true
+			loi.NextMarker = objects[n-1].Name
+			break
+		}
+		// the object unpinned by others is missing
+		if _, ok := pins.Keys[object.Cid]; !ok {
+			continue
+		}
+		loi.Objects = append(loi.Objects, ObjectInfo{
+			SType:  i.st,
+			Bucket: bucket,
+			Name:   object.Name,
+			Size:   object.Size,
+			Cid:    object.Cid,
+		})
+	}
+
+	return loi, nil
+}
+
+// DeleteObject unpins the object, which is the cid returned from PutObject
+func (i *Ipfs) DeleteObject(ctx context.Context, bucket, object string) error {
+	params := url.Values{}
+	params.Set("arg", object)
+	res, err := i.call(ctx, "pin/rm", params, nil, "")
+	if err != nil {
+		return err
+	}
+	res.Close()
+
+	err = database.DeleteIpfsObjects(object)
+	if err != nil {
+		return i.storageError(err)
+	}
+	return nil
+}
+
+func (i *Ipfs) call(ctx context.Context, cmd string, params url.Values, body io.Reader, contentType string) (io.ReadCloser, error) {
+	u := i.api + "/api/v0/" + cmd
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	// kubo only accepts POST on its rpc api
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, body)
+	if err != nil {
+		return nil, i.storageError(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := i.client.Do(req)
+	if err != nil {
+		return nil, i.storageError(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		var ierr ipfsError
+		if json.Unmarshal(data, &ierr) == nil && ierr.Message != "" {
+			return nil, i.storageError(xerrors.Errorf("%s: %s", cmd, ierr.Message))
+		}
+		return nil, i.storageError(xerrors.Errorf("%s: %s %s", cmd, res.Status, string(data)))
+	}
+
+	return res.Body, nil
+}
+
+func (i *Ipfs) storageError(err error) error {
+	lerr := logs.StorageError{Storage: i.st.String(), Message: err.Error()}
+	logger.Error(lerr)
+	return lerr
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
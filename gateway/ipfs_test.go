@@ -0,0 +1,193 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/memoio/meeda-node/database"
+)
+
+// kuboStub serves the commands of the kubo rpc api used by the gateway,
+// the content is addressed by its sha256
+type kuboStub struct {
+	lk     sync.Mutex
+	blocks map[string][]byte
+	pins   map[string]bool
+}
+
+func newKuboStub(t *testing.T) *httptest.Server {
+	k := &kuboStub{blocks: make(map[string][]byte), pins: make(map[string]bool)}
+	srv := httptest.NewServer(k)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (k *kuboStub) fail(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(ipfsError{Message: message, Code: 0, Type: "error"})
+}
+
+func (k *kuboStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	k.lk.Lock()
+	defer k.lk.Unlock()
+
+	arg := r.URL.Query().Get("arg")
+	switch strings.TrimPrefix(r.URL.Path, "/api/v0/") {
+	case "version":
+		json.NewEncoder(w).Encode(map[string]string{"Version": "0.0.0-stub"})
+	case "add":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			k.fail(w, err.Error())
+			return
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			k.fail(w, err.Error())
+			return
+		}
+		sum := sha256.Sum256(data)
+		cid := "bafy" + hex.EncodeToString(sum[:])
+		k.blocks[cid] = data
+		if r.URL.Query().Get("pin") == "true" {
+			k.pins[cid] = true
+		}
+		json.NewEncoder(w).Encode(ipfsAddResult{Name: cid, Hash: cid, Size: strconv.Itoa(len(data) + 11)})
+	case "cat":
+		data, ok := k.blocks[arg]
+		if !ok {
+			k.fail(w, "block was not found locally (offline)")
+			return
+		}
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset > len(data) {
+			offset = len(data)
+		}
+		data = data[offset:]
+		if length, err := strconv.Atoi(r.URL.Query().Get("length")); err == nil && length < len(data) {
+			data = data[:length]
+		}
+		w.Write(data)
+	case "pin/ls":
+		var res ipfsPinLsResult
+		res.Keys = make(map[string]struct{ Type string })
+		for cid := range k.pins {
+			res.Keys[cid] = struct{ Type string }{"recursive"}
+		}
+		json.NewEncoder(w).Encode(res)
+	case "pin/rm":
+		if !k.pins[arg] {
+			k.fail(w, "not pinned or pinned indirectly")
+			return
+		}
+		delete(k.pins, arg)
+		json.NewEncoder(w).Encode(map[string][]string{"Pins": {arg}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestIpfs(t *testing.T) {
+	err := database.InitDatabase(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	srv := newKuboStub(t)
+	gw, err := NewIpfsGateway(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("meeda"), 100000)
+	a, err := gw.PutObject(ctx, "bucket", "a", bytes.NewReader(data), ObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Size != int64(len(data)) {
+		t.Fatalf("size of the put object = %d, want %d", a.Size, len(data))
+	}
+	b, err := gw.PutObject(ctx, "bucket", "ns/b", strings.NewReader("other data"), ObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = gw.PutObject(ctx, "other", "c", strings.NewReader("other bucket"), ObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts ObjectOptions
+		want []byte
+	}{
+		{"whole", ObjectOptions{}, data},
+		{"range", ObjectOptions{Offset: 5, Length: 10}, data[5:15]},
+		{"tail", ObjectOptions{Offset: int64(len(data)) - 3}, data[len(data)-3:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w bytes.Buffer
+			err := gw.GetObject(ctx, a.Cid, &w, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(w.Bytes(), tt.want) {
+				t.Fatalf("got %d bytes, want %d", w.Len(), len(tt.want))
+			}
+		})
+	}
+	err = gw.GetObject(ctx, a.Cid, io.Discard, ObjectOptions{Offset: -1})
+	if err == nil {
+		t.Fatal("got an illegal range")
+	}
+	err = gw.GetObject(ctx, "bafymissing", io.Discard, ObjectOptions{})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("get of a missing cid returns %v", err)
+	}
+
+	loi, err := gw.ListObjects(ctx, "bucket", ListObjectsOptions{MaxKeys: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loi.Objects) != 1 || loi.Objects[0].Name != "a" || !loi.IsTruncated {
+		t.Fatalf("first page is %+v", loi)
+	}
+	loi, err = gw.ListObjects(ctx, "bucket", ListObjectsOptions{Marker: loi.NextMarker})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loi.Objects) != 1 || loi.Objects[0].Name != "ns/b" || loi.Objects[0].Cid != b.Cid || loi.IsTruncated {
+		t.Fatalf("second page is %+v", loi)
+	}
+
+	err = gw.DeleteObject(ctx, "bucket", b.Cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gw.DeleteObject(ctx, "bucket", b.Cid)
+	if err == nil {
+		t.Fatal("unpinned an object twice")
+	}
+	loi, err = gw.ListObjects(ctx, "bucket", ListObjectsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loi.Objects) != 1 || loi.Objects[0].Cid != a.Cid {
+		t.Fatalf("objects left are %+v", loi.Objects)
+	}
+}
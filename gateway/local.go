@@ -0,0 +1,363 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	metag "github.com/memoio/go-mefs-v2/lib/etag"
+	"github.com/memoio/meeda-node/logs"
+	"github.com/mitchellh/go-homedir"
+)
+
+var _ IGateway = (*Local)(nil)
+
+// Local keeps blobs on the local disk, addressed by the same cid mefs
+// computes for them, so the store node can run without a mefs user node.
+//
+// layout:
+//
+//	<root>/blobs/<cid>                  object content
+//	<root>/objects/<bucket>/<object>    json encoded localObject
+//	<root>/tmp                          staging area for atomic writes
+type Local struct {
+	st   StorageType
+	root string
+
+	// lk guards the names of the objects and refs, the content is staged
+	// without it
+	lk sync.RWMutex
+	// refs counts the objects referring to each cid, it is loaded from the
+	// objects when the gateway is opened
+	refs map[string]int
+}
+
+type localObject struct {
+	Cid         string
+	Size        int64
+	ModTime     time.Time
+	UserDefined map[string]string
+}
+
+func NewLocalGateway(path string) (IGateway, error) {
+	root, err := homedir.Expand(path)
+	if err != nil {
+		lerr := logs.StorageError{Storage: LOCAL.String(), Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	if root == "" {
+		lerr := logs.StorageError{Storage: LOCAL.String(), Message: "local storage path is not set"}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	for _, dir := range []string{"blobs", "objects", "tmp"} {
+		err = os.MkdirAll(filepath.Join(root, dir), 0755)
+		if err != nil {
+			lerr := logs.StorageError{Storage: LOCAL.String(), Message: err.Error()}
+			logger.Error(lerr)
+			return nil, lerr
+		}
+	}
+
+	l := &Local{
+		st:   LOCAL,
+		root: root,
+		refs: make(map[string]int),
+	}
+	err = filepath.WalkDir(filepath.Join(root, "objects"), func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		meta, err := readLocalObject(path)
+		if err != nil {
+			return err
+		}
+		l.refs[meta.Cid]++
+		return nil
+	})
+	if err != nil {
+		return nil, l.storageError(err)
+	}
+
+	return l, nil
+}
+
+func (l *Local) GetStoreType(ctx context.Context) StorageType {
+	return l.st
+}
+
+func (l *Local) PutObject(ctx context.Context, bucket, object string, r io.Reader, opts ObjectOptions) (objInfo ObjectInfo, err error) {
+	objPath, err := l.objectPath(bucket, object)
+	if err != nil {
+		return objInfo, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(l.root, "tmp"), "blob-")
+	if err != nil {
+		return objInfo, l.storageError(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	tree := metag.NewTree()
+	size, err := io.Copy(io.MultiWriter(tmp, tree), r)
+	if err != nil {
+		tmp.Close()
+		return objInfo, l.storageError(err)
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return objInfo, l.storageError(err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return objInfo, l.storageError(err)
+	}
+
+	cid, err := metag.ToString(tree.Sum(nil))
+	if err != nil {
+		return objInfo, l.storageError(err)
+	}
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	// the same content may already be stored under another name
+	blobPath := l.blobPath(cid)
+	if _, err := os.Stat(blobPath); os.IsNotExist(err) {
+		err = os.Rename(tmp.Name(), blobPath)
+		if err != nil {
+			return objInfo, l.storageError(err)
+		}
+		err = syncDir(filepath.Dir(blobPath))
+		if err != nil {
+			return objInfo, l.storageError(err)
+		}
+	}
+
+	// the content is restored above even if the object exists
+	if _, err := os.Stat(objPath); err == nil {
+		lerr := logs.StorageError{Storage: l.st.String(), Message: object + " already exist"}
+		logger.Error(lerr)
+		return objInfo, lerr
+	}
+
+	meta := localObject{
+		Cid:         cid,
+		Size:        size,
+		ModTime:     time.Now(),
+		UserDefined: opts.UserDefined,
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return objInfo, l.storageError(err)
+	}
+	err = os.MkdirAll(filepath.Dir(objPath), 0755)
+	if err != nil {
+		return objInfo, l.storageError(err)
+	}
+	err = writeFileAtomic(filepath.Join(l.root, "tmp"), objPath, data)
+	if err != nil {
+		return objInfo, l.storageError(err)
+	}
+	l.refs[cid]++
+
+	return ObjectInfo{
+		SType:       l.st,
+		Bucket:      bucket,
+		Name:        object,
+		Size:        size,
+		Cid:         cid,
+		ModTime:     meta.ModTime,
+		UserDefined: meta.UserDefined,
+	}, nil
+}
+
+// GetObject reads the object, or the range of it selected by opts, by the
+// cid returned from PutObject
+func (l *Local) GetObject(ctx context.Context, objectName string, writer io.Writer, opts ObjectOptions) error {
+	if !validName(objectName) {
+		return l.storageError(logs.ErrNotExist)
+	}
+
+	// the content opened is kept readable even if it is deleted meanwhile
+	l.lk.RLock()
+	f, err := os.Open(l.blobPath(objectName))
+	l.lk.RUnlock()
+	if err != nil {
+		return l.storageError(err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return l.storageError(err)
+	}
+	start, length, err := opts.Range(fi.Size())
+	if err != nil {
+		return l.storageError(err)
+	}
+	_, err = f.Seek(start, io.SeekStart)
+	if err != nil {
+		return l.storageError(err)
+	}
+
+	_, err = io.CopyN(writer, f, length)
+	if err != nil {
+		return l.storageError(err)
+	}
+	return nil
+}
+
+func (l *Local) ListObjects(ctx context.Context, bucket string, opts ListObjectsOptions) (ListObjectsInfo, error) {
+	var loi ListObjectsInfo
+	if !validName(bucket) {
+		return loi, l.storageError(logs.ErrNotExist)
+	}
+
+	l.lk.RLock()
+	defer l.lk.RUnlock()
+
+	entries, err := os.ReadDir(filepath.Join(l.root, "objects", bucket))
+	if err != nil {
+		return loi, l.storageError(err)
+	}
+
+	var objs []ObjectInfo
+	for _, entry := range entries {
+		name, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			return loi, l.storageError(err)
+		}
+		if name <= opts.Marker || !strings.HasPrefix(name, opts.Prefix) {
+			continue
+		}
+		meta, err := readLocalObject(filepath.Join(l.root, "objects", bucket, entry.Name()))
+		if err != nil {
+			return loi, l.storageError(err)
+		}
+		objs = append(objs, ObjectInfo{
+			SType:       l.st,
+			Bucket:      bucket,
+			Name:        name,
+			Size:        meta.Size,
+			Cid:         meta.Cid,
+			ModTime:     meta.ModTime.UTC(),
+			UserDefined: meta.UserDefined,
+		})
+	}
+
+	return paginate(objs, opts), nil
+}
+
+func (l *Local) DeleteObject(ctx context.Context, bucket, object string) error {
+	objPath, err := l.objectPath(bucket, object)
+	if err != nil {
+		return err
+	}
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	meta, err := readLocalObject(objPath)
+	if err != nil {
+		return l.storageError(err)
+	}
+	err = os.Remove(objPath)
+	if err != nil {
+		return l.storageError(err)
+	}
+
+	// keep the content while other objects still refer to it
+	l.refs[meta.Cid]--
+	if l.refs[meta.Cid] <= 0 {
+		delete(l.refs, meta.Cid)
+		err = os.Remove(l.blobPath(meta.Cid))
+		if err != nil && !os.IsNotExist(err) {
+			return l.storageError(err)
+		}
+	}
+
+	return syncDir(filepath.Dir(objPath))
+}
+
+func (l *Local) blobPath(cid string) string {
+	return filepath.Join(l.root, "blobs", cid)
+}
+
+func (l *Local) objectPath(bucket, object string) (string, error) {
+	if !validName(bucket) || object == "" {
+		lerr := logs.StorageError{Storage: l.st.String(), Message: "illegal bucket or object name"}
+		logger.Error(lerr)
+		return "", lerr
+	}
+	return filepath.Join(l.root, "objects", bucket, url.PathEscape(object)), nil
+}
+
+func (l *Local) storageError(err error) error {
+	lerr := logs.StorageError{Storage: l.st.String(), Message: err.Error()}
+	logger.Error(lerr)
+	return lerr
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func readLocalObject(path string) (localObject, error) {
+	var meta localObject
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+// writeFileAtomic writes data into a temporary file, syncs it and then
+// renames it over path, so readers never see a partially written file
+func writeFileAtomic(tmpDir, path string, data []byte) error {
+	tmp, err := os.CreateTemp(tmpDir, "meta-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
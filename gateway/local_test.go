@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLocalRefcount(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	gw, err := NewLocalGateway(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(object, data string) ObjectInfo {
+		t.Helper()
+		oi, err := gw.PutObject(ctx, "bucket", object, strings.NewReader(data), ObjectOptions{})
+		if err != nil {
+			t.Fatalf("put %s: %s", object, err)
+		}
+		return oi
+	}
+	get := func(cid string, opts ObjectOptions) (string, error) {
+		var w bytes.Buffer
+		err := gw.GetObject(ctx, cid, &w, opts)
+		return w.String(), err
+	}
+
+	a := put("a", "shared data")
+	b := put("b", "shared data")
+	c := put("ns/c", "other data")
+	if a.Cid != b.Cid {
+		t.Fatalf("the same data has cids %s and %s", a.Cid, b.Cid)
+	}
+	if a.Cid == c.Cid {
+		t.Fatalf("different data has the same cid %s", a.Cid)
+	}
+
+	_, err = gw.PutObject(ctx, "bucket", "a", strings.NewReader("shared data"), ObjectOptions{})
+	if err == nil || !strings.Contains(err.Error(), "exist") {
+		t.Fatalf("put of an existing object returns %v", err)
+	}
+
+	// the references are counted again when the gateway is reopened
+	gw, err = NewLocalGateway(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := get(a.Cid, ObjectOptions{})
+	if err != nil || got != "shared data" {
+		t.Fatalf("get = %q, %v", got, err)
+	}
+	got, err = get(a.Cid, ObjectOptions{Offset: 7, Length: 4})
+	if err != nil || got != "data" {
+		t.Fatalf("get of range = %q, %v", got, err)
+	}
+
+	// the content is kept while b still refers to it
+	err = gw.DeleteObject(ctx, "bucket", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = get(a.Cid, ObjectOptions{})
+	if err != nil || got != "shared data" {
+		t.Fatalf("get after deleting one of the objects = %q, %v", got, err)
+	}
+
+	err = gw.DeleteObject(ctx, "bucket", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = get(a.Cid, ObjectOptions{})
+	if err == nil {
+		t.Fatal("the content is kept after all the objects are deleted")
+	}
+
+	got, err = get(c.Cid, ObjectOptions{})
+	if err != nil || got != "other data" {
+		t.Fatalf("get of another object = %q, %v", got, err)
+	}
+	loi, err := gw.ListObjects(ctx, "bucket", ListObjectsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loi.Objects) != 1 || loi.Objects[0].Name != "ns/c" {
+		t.Fatalf("objects left are %+v", loi.Objects)
+	}
+
+	err = gw.DeleteObject(ctx, "bucket", "a")
+	if err == nil {
+		t.Fatal("deleted a missing object")
+	}
+	_, err = get("../blobs", ObjectOptions{})
+	if err == nil {
+		t.Fatal("got an illegal cid")
+	}
+}
+
+func TestLocalConcurrentPut(t *testing.T) {
+	ctx := context.Background()
+	gw, err := NewLocalGateway(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 16
+	var wg sync.WaitGroup
+	ois := make([]ObjectInfo, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ois[i], errs[i] = gw.PutObject(ctx, "bucket", "o"+strconv.Itoa(i), strings.NewReader("shared data"), ObjectOptions{})
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		err = gw.DeleteObject(ctx, "bucket", "o"+strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = gw.GetObject(ctx, ois[0].Cid, io.Discard, ObjectOptions{})
+		if i < n-1 && err != nil {
+			t.Fatalf("the content is deleted with %d objects left: %s", n-1-i, err)
+		}
+		if i == n-1 && err == nil {
+			t.Fatal("the content is kept after all the objects are deleted")
+		}
+	}
+}
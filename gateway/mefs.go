@@ -1,329 +1,509 @@
-package gateway
-
-import (
-	"context"
-	"io"
-	"log"
-	"net/http"
-	"os"
-	"strings"
-	"time"
-
-	mclient "github.com/memoio/go-mefs-v2/api/client"
-	"github.com/memoio/go-mefs-v2/build"
-	mcode "github.com/memoio/go-mefs-v2/lib/code"
-	metag "github.com/memoio/go-mefs-v2/lib/etag"
-	mtypes "github.com/memoio/go-mefs-v2/lib/types"
-	"github.com/memoio/meeda-node/logs"
-	"github.com/memoio/meeda-node/utils"
-)
-
-var logger = logs.Logger("mefs")
-
-var _ IGateway = (*Mefs)(nil)
-
-type Mefs struct {
-	st      StorageType
-	addr    string
-	headers http.Header
-}
-
-func NewGateway() (IGateway, error) {
-	repoDir := os.Getenv("MEFS_PATH")
-	addr, headers, err := mclient.GetMemoClientInfo(repoDir)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return nil, lerr
-	}
-	napi, closer, err := mclient.NewUserNode(context.Background(), addr, headers)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return nil, lerr
-	}
-	defer closer()
-	_, err = napi.ShowStorage(context.Background())
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return nil, lerr
-	}
-
-	return &Mefs{
-		st:      MEFS,
-		addr:    addr,
-		headers: headers,
-	}, nil
-}
-
-func CreateGateWay(api, token string) (IGateway, error) {
-	addr, headers, err := mclient.CreateMemoClientInfo(api, token)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return nil, lerr
-	}
-	napi, closer, err := mclient.NewUserNode(context.Background(), addr, headers)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return nil, lerr
-	}
-	defer closer()
-	_, err = napi.ShowStorage(context.Background())
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return nil, lerr
-	}
-
-	return &Mefs{
-		st:      MEFS,
-		addr:    addr,
-		headers: headers,
-	}, nil
-}
-
-func (m *Mefs) GetStoreType(ctx context.Context) StorageType {
-	return m.st
-}
-
-func (m *Mefs) MakeBucketWithLocation(ctx context.Context, bucket string) error {
-	napi, closer, err := mclient.NewUserNode(ctx, m.addr, m.headers)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return lerr
-	}
-	defer closer()
-	opts := mcode.DefaultBucketOptions()
-
-	_, err = napi.CreateBucket(ctx, bucket, opts)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return lerr
-	}
-	return nil
-}
-
-func (m *Mefs) GetBucketInfo(ctx context.Context, bucket string) (bi mtypes.BucketInfo, err error) {
-	napi, closer, err := mclient.NewUserNode(ctx, m.addr, m.headers)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return bi, lerr
-	}
-	defer closer()
-
-	bi, err = napi.HeadBucket(ctx, bucket)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return bi, lerr
-	}
-	return bi, nil
-}
-
-func (m *Mefs) PutObject(ctx context.Context, bucket, object string, r io.Reader, opts ObjectOptions) (objInfo ObjectInfo, err error) {
-	err = m.MakeBucketWithLocation(ctx, bucket)
-	if err != nil {
-		if !strings.Contains(err.Error(), "already exist") {
-			lerr := logs.StorageError{Message: err.Error()}
-			logger.Error(lerr)
-			return objInfo, lerr
-		}
-	} else {
-		log.Println("create bucket ", bucket)
-		for !m.CheckBucket(ctx, bucket) {
-			time.Sleep(10 * time.Second)
-		}
-	}
-
-	napi, closer, err := mclient.NewUserNode(ctx, m.addr, m.headers)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return objInfo, lerr
-	}
-	defer closer()
-
-	poo := mtypes.CidUploadOption()
-	for k, v := range opts.UserDefined {
-		poo.UserDefined[k] = v
-	}
-	moi, err := napi.PutObject(ctx, bucket, object, r, poo)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return objInfo, lerr
-	}
-
-	etag, _ := metag.ToString(moi.ETag)
-
-	return ObjectInfo{
-		Bucket:      bucket,
-		Name:        moi.Name,
-		Size:        int64(moi.Size),
-		Cid:         etag,
-		ModTime:     time.Unix(moi.GetTime(), 0),
-		UserDefined: moi.UserDefined,
-		SType:       m.st,
-	}, nil
-}
-
-func (m *Mefs) GetObject(ctx context.Context, objectName string, writer io.Writer, opts ObjectOptions) error {
-	napi, closer, err := mclient.NewUserNode(ctx, m.addr, m.headers)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return lerr
-	}
-	defer closer()
-
-	objInfo, err := napi.HeadObject(ctx, "", objectName)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return lerr
-	}
-
-	length := int64(objInfo.Size)
-
-	stepLen := int64(build.DefaultSegSize * 16)
-	stepAccMax := 16
-
-	start := int64(0)
-	end := length
-	stepacc := 1
-	for start < end {
-		if stepacc > stepAccMax {
-			stepacc = stepAccMax
-		}
-
-		readLen := stepLen*int64(stepacc) - (start % stepLen)
-		if end-start < readLen {
-			readLen = end - start
-		}
-
-		doo := mtypes.DownloadObjectOptions{
-			Start:  start,
-			Length: readLen,
-		}
-
-		data, err := napi.GetObject(ctx, "", objectName, doo)
-		if err != nil {
-			//log.Println("received length err is:", start, readLen, stepLen, err)
-			break
-		}
-		writer.Write(data)
-		start += int64(readLen)
-		stepacc *= 2
-	}
-
-	return nil
-}
-
-func (m *Mefs) GetObjectEtag(ctx context.Context, bucket, object string) (string, error) {
-	napi, closer, err := mclient.NewUserNode(ctx, m.addr, m.headers)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return "", lerr
-	}
-	defer closer()
-
-	objInfo, err := napi.HeadObject(ctx, bucket, object)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return "", lerr
-	}
-	return metag.ToString(objInfo.ETag)
-}
-
-func (m *Mefs) GetObjectInfo(ctx context.Context, cid string) (ObjectInfo, error) {
-	result := ObjectInfo{}
-	napi, closer, err := mclient.NewUserNode(ctx, m.addr, m.headers)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return result, lerr
-	}
-	defer closer()
-
-	objInfo, err := napi.HeadObject(ctx, "", cid)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return result, lerr
-	}
-	ctype := utils.TypeByExtension(objInfo.Name)
-	if objInfo.UserDefined["content-type"] != "" {
-		ctype = objInfo.UserDefined["content-type"]
-	}
-	return ObjectInfo{
-		Name:  objInfo.Name,
-		Size:  int64(objInfo.Size),
-		CType: ctype,
-	}, nil
-}
-
-func (m *Mefs) ListObjects(ctx context.Context, bucket string) ([]ObjectInfo, error) {
-	var loi []ObjectInfo
-	napi, closer, err := mclient.NewUserNode(ctx, m.addr, m.headers)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return loi, lerr
-	}
-	defer closer()
-	mloi, err := napi.ListObjects(ctx, bucket, mtypes.ListObjectsOptions{MaxKeys: 1000})
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return loi, lerr
-	}
-
-	for _, oi := range mloi.Objects {
-		etag, _ := metag.ToString(oi.ETag)
-		loi = append(loi, ObjectInfo{
-			Bucket:      bucket,
-			Name:        oi.GetName(),
-			ModTime:     time.Unix(oi.GetTime(), 0).UTC(),
-			Size:        int64(oi.Size),
-			Cid:         etag,
-			UserDefined: oi.UserDefined,
-		})
-	}
-
-	return loi, nil
-}
-
-func (m *Mefs) DeleteObject(ctx context.Context, bucket, object string) error {
-	napi, closer, err := mclient.NewUserNode(ctx, m.addr, m.headers)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return lerr
-	}
-	defer closer()
-
-	err = napi.DeleteObject(ctx, bucket, object)
-	if err != nil {
-		lerr := logs.StorageError{Message: err.Error()}
-		logger.Error(lerr)
-		return lerr
-	}
-	return nil
-}
-
-func (m *Mefs) CheckBucket(ctx context.Context, bucket string) bool {
-	bi, err := m.GetBucketInfo(ctx, bucket)
-	if err != nil {
-		return false
-	}
-
-	return bi.Confirmed
-}
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	mapi "github.com/memoio/go-mefs-v2/api"
+	mclient "github.com/memoio/go-mefs-v2/api/client"
+	"github.com/memoio/go-mefs-v2/build"
+	mcode "github.com/memoio/go-mefs-v2/lib/code"
+	metag "github.com/memoio/go-mefs-v2/lib/etag"
+	mtypes "github.com/memoio/go-mefs-v2/lib/types"
+	"github.com/memoio/meeda-node/logs"
+	"github.com/memoio/meeda-node/utils"
+	"golang.org/x/xerrors"
+)
+
+var logger = logs.Logger("mefs")
+
+var _ IGateway = (*Mefs)(nil)
+
+var (
+	// deadline of a single rpc call to the mefs user node, uploads are
+	// bounded by the context of the caller only
+	mefsCallTimeout = 2 * time.Minute
+	// backoff between reconnecting to an unreachable mefs user node
+	mefsMinBackoff = time.Second
+	mefsMaxBackoff = time.Minute
+)
+
+// Mefs keeps one long-lived connection to the mefs user node, which is
+// dropped when a call fails on the transport and dialed again on the next
+// call, backing off while the node stays unreachable.
+type Mefs struct {
+	st      StorageType
+	addr    string
+	headers http.Header
+
+	lk       sync.Mutex
+	napi     mapi.UserNode
+	closer   func()
+	backoff  time.Duration
+	nextDial time.Time
+}
+
+func NewGateway() (IGateway, error) {
+	repoDir := os.Getenv("MEFS_PATH")
+	addr, headers, err := mclient.GetMemoClientInfo(repoDir)
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	return newMefs(addr, headers)
+}
+
+func CreateGateWay(api, token string) (IGateway, error) {
+	addr, headers, err := mclient.CreateMemoClientInfo(api, token)
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	return newMefs(addr, headers)
+}
+
+func newMefs(addr string, headers http.Header) (*Mefs, error) {
+	m := &Mefs{
+		st:      MEFS,
+		addr:    addr,
+		headers: headers,
+	}
+
+	err := m.Health(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *Mefs) GetStoreType(ctx context.Context) StorageType {
+	return m.st
+}
+
+// Health checks the mefs user node is reachable and serving
+func (m *Mefs) Health(ctx context.Context) error {
+	err := m.call(ctx, func(ctx context.Context, napi mapi.UserNode) error {
+		_, err := napi.ShowStorage(ctx)
+		return err
+	})
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// Close releases the connection to the mefs user node
+func (m *Mefs) Close() {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if m.closer != nil {
+		m.closer()
+	}
+	m.napi = nil
+	m.closer = nil
+}
+
+// call runs fn on the shared connection with a deadline
+func (m *Mefs) call(ctx context.Context, fn func(context.Context, mapi.UserNode) error) error {
+	return m.callTimeout(ctx, mefsCallTimeout, fn)
+}
+
+// callTimeout runs fn on the shared connection, with no deadline if timeout
+// is 0. A call which runs out of time leaves the connection alone.
+func (m *Mefs) callTimeout(ctx context.Context, timeout time.Duration, fn func(context.Context, mapi.UserNode) error) error {
+	napi, err := m.node()
+	if err != nil {
+		return err
+	}
+
+	var cctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		cctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		cctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	err = fn(cctx, napi)
+	if err != nil && cctx.Err() == nil && isConnError(err) {
+		logger.Warnf("connection to mefs %s is broken: %s", m.addr, err)
+		m.drop(napi)
+	}
+	return err
+}
+
+func (m *Mefs) node() (mapi.UserNode, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if m.napi != nil {
+		return m.napi, nil
+	}
+
+	if wait := time.Until(m.nextDial); wait > 0 {
+		return nil, xerrors.Errorf("mefs %s is unreachable, retry in %s", m.addr, wait.Round(time.Second))
+	}
+
+	// the connection outlives the call which dials it
+	napi, closer, err := mclient.NewUserNode(context.Background(), m.addr, m.headers)
+	if err != nil {
+		m.backoff *= 2
+		if m.backoff < mefsMinBackoff {
+			m.backoff = mefsMinBackoff
+		}
+		if m.backoff > mefsMaxBackoff {
+			m.backoff = mefsMaxBackoff
+		}
+		m.nextDial = time.Now().Add(m.backoff)
+		return nil, err
+	}
+
+	m.napi = napi
+	m.closer = closer
+	m.backoff = 0
+	m.nextDial = time.Time{}
+	return napi, nil
+}
+
+func (m *Mefs) drop(napi mapi.UserNode) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	// another call may have reconnected already
+	if m.napi != napi {
+		return
+	}
+	if m.closer != nil {
+		m.closer()
+	}
+	m.napi = nil
+	m.closer = nil
+}
+
+// isConnError reports whether err is a failure of the transport rather than
+// an error returned by the mefs user node
+func isConnError(err error) bool {
+	var oerr *net.OpError
+	if errors.As(err, &oerr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// the rpc client wraps the errors of the websocket in text
+	msg := err.Error()
+	for _, s := range []string{"RPC client error", "websocket: close", "connection reset", "connection refused", "broken pipe"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Mefs) MakeBucketWithLocation(ctx context.Context, bucket string) error {
+	opts := mcode.DefaultBucketOptions()
+
+	err := m.call(ctx, func(ctx context.Context, napi mapi.UserNode) error {
+		_, err := napi.CreateBucket(ctx, bucket, opts)
+		return err
+	})
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+func (m *Mefs) GetBucketInfo(ctx context.Context, bucket string) (bi mtypes.BucketInfo, err error) {
+	err = m.call(ctx, func(ctx context.Context, napi mapi.UserNode) error {
+		bi, err = napi.HeadBucket(ctx, bucket)
+		return err
+	})
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return bi, lerr
+	}
+	return bi, nil
+}
+
+func (m *Mefs) PutObject(ctx context.Context, bucket, object string, r io.Reader, opts ObjectOptions) (objInfo ObjectInfo, err error) {
+	err = m.MakeBucketWithLocation(ctx, bucket)
+	if err != nil {
+		if !strings.Contains(err.Error(), "already exist") {
+			lerr := logs.StorageError{Message: err.Error()}
+			logger.Error(lerr)
+			return objInfo, lerr
+		}
+	} else {
+		log.Println("create bucket ", bucket)
+		for !m.CheckBucket(ctx, bucket) {
+			time.Sleep(10 * time.Second)
+		}
+	}
+
+	poo := mtypes.CidUploadOption()
+	for k, v := range opts.UserDefined {
+		poo.UserDefined[k] = v
+	}
+
+	var moi mtypes.ObjectInfo
+	// the upload takes as long as the data needs
+	err = m.callTimeout(ctx, 0, func(ctx context.Context, napi mapi.UserNode) error {
+		moi, err = napi.PutObject(ctx, bucket, object, r, poo)
+		return err
+	})
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return objInfo, lerr
+	}
+
+	etag, _ := metag.ToString(moi.ETag)
+
+	return ObjectInfo{
+		Bucket:      bucket,
+		Name:        moi.Name,
+		Size:        int64(moi.Size),
+		Cid:         etag,
+		ModTime:     time.Unix(moi.GetTime(), 0),
+		UserDefined: moi.UserDefined,
+		SType:       m.st,
+	}, nil
+}
+
+// GetObject streams the object, or the range of it selected by opts, into
+// writer and fails unless every byte of the range is written
+func (m *Mefs) GetObject(ctx context.Context, objectName string, writer io.Writer, opts ObjectOptions) error {
+	r, err := m.GetObjectReader(ctx, objectName, opts)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(writer, r)
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	if n != r.length {
+		lerr := logs.StorageError{Message: fmt.Sprintf("read %d bytes of %s, expected %d", n, objectName, r.length)}
+		logger.Error(lerr)
+		return lerr
+	}
+
+	return nil
+}
+
+// GetObjectReader returns a reader which downloads the object in growing
+// steps on demand
+func (m *Mefs) GetObjectReader(ctx context.Context, objectName string, opts ObjectOptions) (*MefsObjectReader, error) {
+	var objInfo mtypes.ObjectInfo
+	err := m.call(ctx, func(ctx context.Context, napi mapi.UserNode) (err error) {
+		objInfo, err = napi.HeadObject(ctx, "", objectName)
+		return err
+	})
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	start, length, err := opts.Range(int64(objInfo.Size))
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	return &MefsObjectReader{
+		m:       m,
+		ctx:     ctx,
+		name:    objectName,
+		start:   start,
+		end:     start + length,
+		length:  length,
+		stepacc: 1,
+	}, nil
+}
+
+type MefsObjectReader struct {
+	m    *Mefs
+	ctx  context.Context
+	name string
+
+	start   int64
+	end     int64
+	length  int64
+	stepacc int64
+	buf     []byte
+}
+
+func (r *MefsObjectReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.start >= r.end {
+			return 0, io.EOF
+		}
+		err := r.next()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *MefsObjectReader) next() error {
+	stepLen := int64(build.DefaultSegSize * 16)
+	stepAccMax := int64(16)
+
+	if r.stepacc > stepAccMax {
+		r.stepacc = stepAccMax
+	}
+
+	readLen := stepLen*r.stepacc - (r.start % stepLen)
+	if r.end-r.start < readLen {
+		readLen = r.end - r.start
+	}
+
+	doo := mtypes.DownloadObjectOptions{
+		Start:  r.start,
+		Length: readLen,
+	}
+
+	var data []byte
+	err := r.m.call(r.ctx, func(ctx context.Context, napi mapi.UserNode) (err error) {
+		data, err = napi.GetObject(ctx, "", r.name, doo)
+		return err
+	})
+	if err != nil {
+		return xerrors.Errorf("read %s at %d+%d: %w", r.name, r.start, readLen, err)
+	}
+	if int64(len(data)) != readLen {
+		return xerrors.Errorf("read %s at %d+%d: got %d bytes", r.name, r.start, readLen, len(data))
+	}
+
+	r.buf = data
+	r.start += readLen
+	r.stepacc *= 2
+	return nil
+}
+
+func (m *Mefs) GetObjectEtag(ctx context.Context, bucket, object string) (string, error) {
+	var objInfo mtypes.ObjectInfo
+	err := m.call(ctx, func(ctx context.Context, napi mapi.UserNode) (err error) {
+		objInfo, err = napi.HeadObject(ctx, bucket, object)
+		return err
+	})
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return "", lerr
+	}
+	return metag.ToString(objInfo.ETag)
+}
+
+func (m *Mefs) GetObjectInfo(ctx context.Context, cid string) (ObjectInfo, error) {
+	result := ObjectInfo{}
+	var objInfo mtypes.ObjectInfo
+	err := m.call(ctx, func(ctx context.Context, napi mapi.UserNode) (err error) {
+		objInfo, err = napi.HeadObject(ctx, "", cid)
+		return err
+	})
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return result, lerr
+	}
+	ctype := utils.TypeByExtension(objInfo.Name)
+	if objInfo.UserDefined["content-type"] != "" {
+		ctype = objInfo.UserDefined["content-type"]
+	}
+	return ObjectInfo{
+		Name:  objInfo.Name,
+		Size:  int64(objInfo.Size),
+		CType: ctype,
+	}, nil
+}
+
+func (m *Mefs) ListObjects(ctx context.Context, bucket string, opts ListObjectsOptions) (ListObjectsInfo, error) {
+	var loi ListObjectsInfo
+	maxKeys := opts.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	var mloi mtypes.ListObjectsInfo
+	err := m.call(ctx, func(ctx context.Context, napi mapi.UserNode) (err error) {
+		mloi, err = napi.ListObjects(ctx, bucket, mtypes.ListObjectsOptions{
+			Prefix:  opts.Prefix,
+			Marker:  opts.Marker,
+			MaxKeys: maxKeys,
+		})
+		return err
+	})
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return loi, lerr
+	}
+
+	for _, oi := range mloi.Objects {
+		etag, _ := metag.ToString(oi.ETag)
+		loi.Objects = append(loi.Objects, ObjectInfo{
+			Bucket:      bucket,
+			Name:        oi.GetName(),
+			ModTime:     time.Unix(oi.GetTime(), 0).UTC(),
+			Size:        int64(oi.Size),
+			Cid:         etag,
+			UserDefined: oi.UserDefined,
+		})
+	}
+	loi.IsTruncated = mloi.IsTruncated
+	loi.NextMarker = mloi.NextMarker
+	if loi.IsTruncated && loi.NextMarker == "" && len(loi.Objects) > 0 {
+		loi.NextMarker = loi.Objects[len(loi.Objects)-1].Name
+	}
+
+	return loi, nil
+}
+
+func (m *Mefs) DeleteObject(ctx context.Context, bucket, object string) error {
+	err := m.call(ctx, func(ctx context.Context, napi mapi.UserNode) error {
+		return napi.DeleteObject(ctx, bucket, object)
+	})
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+func (m *Mefs) CheckBucket(ctx context.Context, bucket string) bool {
+	bi, err := m.GetBucketInfo(ctx, bucket)
+	if err != nil {
+		return false
+	}
+
+	return bi.Confirmed
+}
@@ -0,0 +1,457 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metag "github.com/memoio/go-mefs-v2/lib/etag"
+	"github.com/memoio/meeda-node/database"
+	"github.com/memoio/meeda-node/logs"
+	"golang.org/x/xerrors"
+)
+
+var _ IGateway = (*Replicated)(nil)
+
+var repairInterval = time.Minute
+var repairMaxBackoff = 24 * time.Hour
+
+// how often a replica which is down is opened again
+var reopenInterval = 30 * time.Second
+
+// Replicated writes every object into all of its backends and reads from
+// the first one holding an intact copy. Objects are addressed by the cid
+// mefs computes for the content, the cid of each replica is kept in the
+// DAReplicaInfoStore table.
+type Replicated struct {
+	st       StorageType
+	replicas []*replica
+	quorum   int
+}
+
+// replica is down while gw is nil, and is opened again on use
+type replica struct {
+	name string
+	st   StorageType
+	cfg  Config
+
+	lk     sync.Mutex
+	gw     IGateway
+	opened time.Time
+}
+
+func NewReplicatedGateway(cfgs []Config, quorum int) (IGateway, error) {
+	if quorum <= 0 || quorum > len(cfgs) {
+		quorum = len(cfgs)/2 + 1
+	}
+
+	r := &Replicated{
+		st:     REPLICA,
+		quorum: quorum,
+	}
+	opened := 0
+	for i, cfg := range cfgs {
+		name := cfg.Name
+		if name == "" {
+			name = cfg.Type.String() + "-" + strconv.Itoa(i)
+		}
+		// a backend which is down now misses the objects put meanwhile,
+		// they are repaired once it is back
+		rp := &replica{
+			name: name,
+			st:   cfg.Type,
+			cfg:  cfg,
+		}
+		_, err := rp.gateway()
+		if err != nil {
+			logger.Error(err)
+		} else {
+			opened++
+		}
+		r.replicas = append(r.replicas, rp)
+	}
+
+	if opened < quorum {
+		lerr := logs.StorageError{Storage: r.st.String(), Message: "not enough replicas to meet the write quorum"}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	return r, nil
+}
+
+func (r *Replicated) GetStoreType(ctx context.Context) StorageType {
+	return r.st
+}
+
+// Health reports whether enough replicas are healthy to meet the quorum
+func (r *Replicated) Health(ctx context.Context) error {
+	healthy := 0
+	for _, rp := range r.replicas {
+		gw, err := rp.gateway()
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		if h, ok := gw.(IHealth); ok {
+			err := h.Health(ctx)
+			if err != nil {
+				logger.Errorf("replica %s is unhealthy: %s", rp.name, err)
+				continue
+			}
+		}
+		healthy++
+	}
+	if healthy < r.quorum {
+		return r.storageError(xerrors.Errorf("only %d of %d replicas are healthy, quorum is %d", healthy, len(r.replicas), r.quorum))
+	}
+	return nil
+}
+
+// PutObject succeeds once the object is written into quorum backends, the
+// failed replicas are filled in later by Repair
+func (r *Replicated) PutObject(ctx context.Context, bucket, object string, reader io.Reader, opts ObjectOptions) (objInfo ObjectInfo, err error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return objInfo, r.storageError(err)
+	}
+	mid, err := contentCid(data)
+	if err != nil {
+		return objInfo, r.storageError(err)
+	}
+
+	infos := make([]database.DAReplicaInfo, len(r.replicas))
+	var wg sync.WaitGroup
+	for i, rp := range r.replicas {
+		wg.Add(1)
+		go func(i int, rp *replica) {
+			defer wg.Done()
+			infos[i] = database.DAReplicaInfo{
+				Mid:     mid,
+				Backend: rp.name,
+				Bucket:  bucket,
+				Name:    object,
+				Size:    int64(len(data)),
+			}
+			cid, err := rp.put(ctx, bucket, object, mid, data, opts)
+			if err != nil {
+				logger.Errorf("put %s into replica %s: %s", object, rp.name, err)
+				infos[i].Missing = true
+				return
+			}
+			infos[i].Cid = cid
+		}(i, rp)
+	}
+	wg.Wait()
+
+	written := 0
+	for _, info := range infos {
+		if !info.Missing {
+			written++
+		}
+		err = info.SaveDAReplicaInfo()
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+	if written < r.quorum {
+		return objInfo, r.storageError(xerrors.Errorf("only %d of %d replicas are written, quorum is %d", written, len(r.replicas), r.quorum))
+	}
+
+	return ObjectInfo{
+		SType:       r.st,
+		Bucket:      bucket,
+		Name:        object,
+		Size:        int64(len(data)),
+		Cid:         mid,
+		ModTime:     time.Now(),
+		UserDefined: opts.UserDefined,
+	}, nil
+}
+
+// GetObject returns the first replica whose size is the expected one
+func (r *Replicated) GetObject(ctx context.Context, objectName string, writer io.Writer, opts ObjectOptions) error {
+	infos, err := database.GetReplicaInfosByMid(objectName)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	size := opts.Size
+	known := make(map[string]database.DAReplicaInfo, len(infos))
+	for _, info := range infos {
+		known[info.Backend] = info
+		if size == 0 {
+			size = info.Size
+		}
+	}
+	expected := int64(-1)
+	if size > 0 {
+		_, expected, err = opts.Range(size)
+		if err != nil {
+			return r.storageError(err)
+		}
+	}
+
+	for _, rp := range r.replicas {
+		cid := objectName
+		info, ok := known[rp.name]
+		if ok {
+			if info.Missing {
+				continue
+			}
+			cid = info.Cid
+		} else if len(infos) > 0 {
+			// the object is never written into this backend
+			continue
+		}
+
+		gw, err := rp.gateway()
+		if err != nil {
+			// the replica is not lost while it is down
+			logger.Error(err)
+			continue
+		}
+
+		var buf bytes.Buffer
+		err = gw.GetObject(ctx, cid, &buf, opts)
+		// the replica is lost only if the backend does not have it, not
+		// if the backend fails
+		lost := err != nil && isNotFound(err)
+		if err == nil && expected >= 0 && int64(buf.Len()) != expected {
+			err = xerrors.Errorf("got %d bytes, expected %d", buf.Len(), expected)
+			lost = true
+		}
+		if err != nil {
+			logger.Errorf("get %s from replica %s: %s", objectName, rp.name, err)
+			if ok && lost && ctx.Err() == nil {
+				info.Missing = true
+				err = info.SaveDAReplicaInfo()
+				if err != nil {
+					logger.Error(err)
+				}
+			}
+			continue
+		}
+
+		_, err = writer.Write(buf.Bytes())
+		if err != nil {
+			return r.storageError(err)
+		}
+		return nil
+	}
+
+	return r.storageError(xerrors.Errorf("no intact replica of %s is available", objectName))
+}
+
+// ListObjects lists the objects written through the replicated storage, the
+// Cid of each object is its mid
+func (r *Replicated) ListObjects(ctx context.Context, bucket string, opts ListObjectsOptions) (ListObjectsInfo, error) {
+	var loi ListObjectsInfo
+	maxKeys := opts.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	infos, err := database.ListReplicaInfos(bucket, opts.Prefix, opts.Marker, maxKeys+1)
+	if err != nil {
+		return loi, r.storageError(err)
+	}
+
+	for _, info := range infos {
+		if len(loi.Objects) == maxKeys {
+			loi.IsTruncated = true
+			loi.NextMarker = loi.Objects[maxKeys-1].Name
+			break
+		}
+		loi.Objects = append(loi.Objects, ObjectInfo{
+			SType:  r.st,
+			Bucket: bucket,
+			Name:   info.Name,
+			Size:   info.Size,
+			Cid:    info.Mid,
+		})
+	}
+
+	return loi, nil
+}
+
+func (r *Replicated) DeleteObject(ctx context.Context, bucket, object string) error {
+	infos, err := database.GetReplicaInfosByName(bucket, object)
+	if err != nil {
+		return r.storageError(err)
+	}
+	known := make(map[string]database.DAReplicaInfo, len(infos))
+	for _, info := range infos {
+		known[info.Backend] = info
+	}
+
+	var lerr error
+	for _, rp := range r.replicas {
+		info, ok := known[rp.name]
+		name := object
+		if ok && rp.st == IPFS {
+			name = info.Cid
+		}
+		if !ok || !info.Missing {
+			gw, err := rp.gateway()
+			if err == nil {
+				err = gw.DeleteObject(ctx, bucket, name)
+			}
+			if err != nil {
+				lerr = err
+				continue
+			}
+		}
+		if ok {
+			err = database.DeleteReplicaInfo(info.Mid, info.Backend)
+			if err != nil {
+				logger.Error(err)
+			}
+		}
+	}
+
+	return lerr
+}
+
+// Repair copies the missing replicas from the intact ones in background
+func (r *Replicated) Repair(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(repairInterval):
+		}
+
+		infos, err := database.GetMissingReplicaInfos(time.Now().Unix(), 100)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+
+		for _, info := range infos {
+			err := r.repair(ctx, info)
+			if err != nil {
+				logger.Errorf("repair %s in replica %s: %s", info.Mid, info.Backend, err)
+				// the failed ones are retried later, after the others
+				nextTry := time.Now().Add(repairBackoff(info.Attempts + 1)).Unix()
+				err = database.RecordReplicaRepairAttempt(info.Mid, info.Backend, nextTry)
+				if err != nil {
+					logger.Error(err)
+				}
+				continue
+			}
+			logger.Infof("repaired %s in replica %s", info.Mid, info.Backend)
+		}
+	}
+}
+
+func (r *Replicated) repair(ctx context.Context, info database.DAReplicaInfo) error {
+	var rp *replica
+	for _, x := range r.replicas {
+		if x.name == info.Backend {
+			rp = x
+		}
+	}
+	if rp == nil {
+		return xerrors.Errorf("replica %s is not configured", info.Backend)
+	}
+
+	var buf bytes.Buffer
+	err := r.GetObject(ctx, info.Mid, &buf, ObjectOptions{Size: info.Size})
+	if err != nil {
+		return err
+	}
+
+	cid, err := rp.put(ctx, info.Bucket, info.Name, info.Mid, buf.Bytes(), ObjectOptions{})
+	if err != nil {
+		return err
+	}
+
+	info.Cid = cid
+	info.Missing = false
+	info.Attempts = 0
+	info.NextTry = 0
+	return info.SaveDAReplicaInfo()
+}
+
+// repairBackoff is the delay after the repairs failed, doubling from the
+// repair interval up to repairMaxBackoff
+func repairBackoff(attempts int) time.Duration {
+	backoff := repairInterval
+	for i := 1; i < attempts && backoff < repairMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > repairMaxBackoff {
+		backoff = repairMaxBackoff
+	}
+	return backoff
+}
+
+// isNotFound tells whether the backend failed since it does not have the
+// object, the backends only report it in the message
+func isNotFound(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"not found", "not exist", "no such", "nosuchkey"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// gateway returns the gateway of the replica, and opens it again at most
+// once every reopenInterval while it is down
+func (rp *replica) gateway() (IGateway, error) {
+	rp.lk.Lock()
+	defer rp.lk.Unlock()
+
+	if rp.gw != nil {
+		return rp.gw, nil
+	}
+	if !rp.opened.IsZero() && time.Since(rp.opened) < reopenInterval {
+		return nil, xerrors.Errorf("replica %s is down", rp.name)
+	}
+	rp.opened = time.Now()
+	gw, err := OpenGateway(rp.cfg)
+	if err != nil {
+		return nil, xerrors.Errorf("replica %s is down: %s", rp.name, err)
+	}
+	rp.gw = gw
+	return gw, nil
+}
+
+func (rp *replica) put(ctx context.Context, bucket, object, mid string, data []byte, opts ObjectOptions) (string, error) {
+	gw, err := rp.gateway()
+	if err != nil {
+		return "", err
+	}
+	oi, err := gw.PutObject(ctx, bucket, object, bytes.NewReader(data), opts)
+	if err != nil {
+		// mefs and local storage address the content by the same cid
+		if strings.Contains(err.Error(), "exist") && (rp.st == MEFS || rp.st == LOCAL) {
+			return mid, nil
+		}
+		return "", err
+	}
+	return oi.Cid, nil
+}
+
+func (r *Replicated) storageError(err error) error {
+	lerr := logs.StorageError{Storage: r.st.String(), Message: err.Error()}
+	logger.Error(lerr)
+	return lerr
+}
+
+// contentCid computes the cid mefs gives to data
+func contentCid(data []byte) (string, error) {
+	tree := metag.NewTree()
+	_, err := tree.Write(data)
+	if err != nil {
+		return "", err
+	}
+	return metag.ToString(tree.Sum(nil))
+}
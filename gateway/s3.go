@@ -0,0 +1,426 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/memoio/meeda-node/logs"
+	"golang.org/x/xerrors"
+)
+
+var _ IGateway = (*S3Store)(nil)
+
+// s3UnsignedPayload is signed instead of the sha256 of the objects put, so
+// they are streamed without being read twice
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Store stores blobs in any s3 compatible object storage (minio, qiniu kodo,
+// aws ...) with path style requests signed by aws signature v4. Objects are
+// named exactly as the store node names them, so the Cid returned from
+// PutObject is "<bucket>/<object>".
+type S3Store struct {
+	st        StorageType
+	endpoint  *url.URL
+	accessKey string
+	secretKey string
+	region    string
+	client    *http.Client
+
+	buckets sync.Map
+}
+
+type s3ListBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		LastModified time.Time
+		ETag         string
+		Size         int64
+	}
+}
+
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+func NewS3Gateway(st StorageType, endpoint, accessKey, secretKey, region string) (IGateway, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || u.Host == "" {
+		lerr := logs.StorageError{Storage: st.String(), Message: "illegal s3 endpoint " + endpoint}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	s := &S3Store{
+		st:        st,
+		endpoint:  u,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		region:    region,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+
+	// check the endpoint and credentials by listing buckets
+	res, err := s.do(context.Background(), http.MethodGet, "", "", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	res.Close()
+
+	return s, nil
+}
+
+func (s *S3Store) GetStoreType(ctx context.Context) StorageType {
+	return s.st
+}
+
+func (s *S3Store) MakeBucketWithLocation(ctx context.Context, bucket string) error {
+	var body []byte
+	if s.region != "us-east-1" {
+		body = []byte("<CreateBucketConfiguration><LocationConstraint>" + s.region + "</LocationConstraint></CreateBucketConfiguration>")
+	}
+	res, err := s.do(ctx, http.MethodPut, bucket, "", nil, nil, body)
+	if err != nil {
+		return err
+	}
+	return res.Close()
+}
+
+func (s *S3Store) CheckBucket(ctx context.Context, bucket string) bool {
+	if _, ok := s.buckets.Load(bucket); ok {
+		return true
+	}
+	res, err := s.do(ctx, http.MethodHead, bucket, "", nil, nil, nil)
+	if err != nil {
+		return false
+	}
+	res.Close()
+	s.buckets.Store(bucket, struct{}{})
+	return true
+}
+
+func (s *S3Store) PutObject(ctx context.Context, bucket, object string, r io.Reader, opts ObjectOptions) (objInfo ObjectInfo, err error) {
+	if !s.CheckBucket(ctx, bucket) {
+		err = s.MakeBucketWithLocation(ctx, bucket)
+		if err != nil && !strings.Contains(err.Error(), "BucketAlreadyOwnedByYou") {
+			return objInfo, err
+		}
+		s.buckets.Store(bucket, struct{}{})
+	}
+
+	// the payload is streamed unsigned, while s3 needs its length ahead
+	body, size, err := s3Payload(r, opts.Size)
+	if err != nil {
+		return objInfo, s.storageError(err)
+	}
+	defer body.Close()
+
+	header := http.Header{}
+	for k, v := range opts.UserDefined {
+		if strings.EqualFold(k, "content-type") {
+			header.Set("Content-Type", v)
+			continue
+		}
+		header.Set("X-Amz-Meta-"+k, v)
+	}
+
+	res, err := s.send(ctx, http.MethodPut, bucket, object, nil, header, body, size, s3UnsignedPayload)
+	if err != nil {
+		return objInfo, err
+	}
+	res.Close()
+
+	return ObjectInfo{
+		SType:       s.st,
+		Bucket:      bucket,
+		Name:        object,
+		Size:        size,
+		Cid:         bucket + "/" + object,
+		ModTime:     time.Now(),
+		UserDefined: opts.UserDefined,
+	}, nil
+}
+
+// GetObject reads the object by the "<bucket>/<object>" Cid
+func (s *S3Store) GetObject(ctx context.Context, objectName string, writer io.Writer, opts ObjectOptions) error {
+	bucket, object, ok := strings.Cut(objectName, "/")
+	if !ok || bucket == "" || object == "" {
+		return s.storageError(xerrors.Errorf("illegal object name %s", objectName))
+	}
+
+	var header http.Header
+	if opts.Offset != 0 || opts.Length != 0 {
+		if opts.Offset < 0 || opts.Length < 0 {
+			return s.storageError(xerrors.Errorf("illegal range %d+%d", opts.Offset, opts.Length))
+		}
+		rng := fmt.Sprintf("bytes=%d-", opts.Offset)
+		if opts.Length > 0 {
+			rng += strconv.FormatInt(opts.Offset+opts.Length-1, 10)
+		}
+		header = http.Header{}
+		header.Set("Range", rng)
+	}
+
+	res, err := s.do(ctx, http.MethodGet, bucket, object, nil, header, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	_, err = io.Copy(writer, res)
+	if err != nil {
+		return s.storageError(err)
+	}
+	return nil
+}
+
+// ListObjects lists a page of objects by ListObjectsV2, the NextMarker is
+// the continuation token of s3
+func (s *S3Store) ListObjects(ctx context.Context, bucket string, opts ListObjectsOptions) (ListObjectsInfo, error) {
+	var loi ListObjectsInfo
+	maxKeys := opts.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("max-keys", strconv.Itoa(maxKeys))
+	if opts.Prefix != "" {
+		query.Set("prefix", opts.Prefix)
+	}
+	if opts.Marker != "" {
+		query.Set("continuation-token", opts.Marker)
+	}
+
+	res, err := s.do(ctx, http.MethodGet, bucket, "", query, nil, nil)
+	if err != nil {
+		return loi, err
+	}
+	defer res.Close()
+
+	var result s3ListBucketResult
+	err = xml.NewDecoder(res).Decode(&result)
+	if err != nil {
+		return loi, s.storageError(err)
+	}
+
+	for _, oi := range result.Contents {
+		loi.Objects = append(loi.Objects, ObjectInfo{
+			SType:   s.st,
+			Bucket:  bucket,
+			Name:    oi.Key,
+			ModTime: oi.LastModified.UTC(),
+			Size:    oi.Size,
+			Cid:     bucket + "/" + oi.Key,
+		})
+	}
+	loi.IsTruncated = result.IsTruncated && result.NextContinuationToken != ""
+	loi.NextMarker = result.NextContinuationToken
+
+	return loi, nil
+}
+
+func (s *S3Store) DeleteObject(ctx context.Context, bucket, object string) error {
+	res, err := s.do(ctx, http.MethodDelete, bucket, object, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return res.Close()
+}
+
+func (s *S3Store) do(ctx context.Context, method, bucket, object string, query url.Values, header http.Header, body []byte) (io.ReadCloser, error) {
+	payloadHash := sha256.Sum256(body)
+	return s.send(ctx, method, bucket, object, query, header, bytes.NewReader(body), int64(len(body)), hex.EncodeToString(payloadHash[:]))
+}
+
+// send requests s3 with the body of size bytes, whose sha256 in hex or
+// UNSIGNED-PAYLOAD is signed
+func (s *S3Store) send(ctx context.Context, method, bucket, object string, query url.Values, header http.Header, body io.Reader, size int64, payloadHash string) (io.ReadCloser, error) {
+	u := *s.endpoint
+	u.Path = s.endpoint.Path + "/"
+	if bucket != "" {
+		u.Path += bucket
+		if object != "" {
+			u.Path += "/" + object
+		}
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, s.storageError(err)
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, payloadHash, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, s.storageError(err)
+	}
+
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		var serr s3Error
+		if xml.Unmarshal(data, &serr) == nil && serr.Code != "" {
+			return nil, s.storageError(xerrors.Errorf("%s %s: %s", serr.Code, u.Path, serr.Message))
+		}
+		return nil, s.storageError(xerrors.Errorf("%s %s: %s", method, u.Path, res.Status))
+	}
+
+	return res.Body, nil
+}
+
+// sign adds aws signature v4 headers to req, payloadHash is the sha256 of
+// the body in hex or UNSIGNED-PAYLOAD
+func (s *S3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	var signed []string
+	for k := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "host" || lk == "content-type" || lk == "range" || strings.HasPrefix(lk, "x-amz-") {
+			signed = append(signed, lk)
+		}
+	}
+	sort.Strings(signed)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range signed {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(req.Header.Get(k)) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, false),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func (s *S3Store) storageError(err error) error {
+	lerr := logs.StorageError{Storage: s.st.String(), Message: err.Error()}
+	logger.Error(lerr)
+	return lerr
+}
+
+// s3Payload returns the body of size bytes to put, r of unknown size is
+// staged in a temporary file instead of the memory
+func s3Payload(r io.Reader, size int64) (io.ReadCloser, int64, error) {
+	if size > 0 {
+		return io.NopCloser(r), size, nil
+	}
+
+	f, err := os.CreateTemp("", "meeda-s3-")
+	if err != nil {
+		return nil, 0, err
+	}
+	body := &tempFile{f}
+	size, err = io.Copy(f, r)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		body.Close()
+		return nil, 0, err
+	}
+	return body, size, nil
+}
+
+// tempFile is removed when it is closed
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape uri encodes s as required by signature v4, '/' is kept in paths
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString(fmt.Sprintf("%%%02X", c))
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -1,57 +1,177 @@
-package gateway
-
-import (
-	"math/big"
-	"time"
-)
-
-type ObjectInfo struct {
-	SType       StorageType
-	Bucket      string
-	Name        string
-	Size        int64
-	Cid         string
-	ModTime     time.Time
-	CType       string
-	UserDefined map[string]string
-}
-
-type ObjectOptions struct {
-	Size         int64
-	Sign         string
-	Area         string
-	MTime        time.Time
-	DeleteMarker bool
-	UserDefined  map[string]string
-}
-
-type StorageType uint8
-
-const (
-	MEFS StorageType = iota
-	IPFS
-	QINIU
-)
-
-func (s StorageType) String() string {
-	switch s {
-	case MEFS:
-		return "mefs"
-	case IPFS:
-		return "ipfs"
-	case QINIU:
-		return "qiniu"
-	default:
-		return "unknow storage"
-	}
-}
-
-func StringToStorageType(s string) StorageType {
-	storage := new(big.Int)
-	storage.SetString(s, 10)
-	return StorageType(storage.Uint64())
-}
-
-func Uint8ToStorageType(s uint8) StorageType {
-	return StorageType(s)
-}
+package gateway
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/memoio/meeda-node/logs"
+)
+
+type ObjectInfo struct {
+	SType       StorageType
+	Bucket      string
+	Name        string
+	Size        int64
+	Cid         string
+	ModTime     time.Time
+	CType       string
+	UserDefined map[string]string
+}
+
+type ObjectOptions struct {
+	Size         int64
+	Sign         string
+	Area         string
+	MTime        time.Time
+	DeleteMarker bool
+	UserDefined  map[string]string
+
+	// byte range read by GetObject, zero Length means up to the end
+	Offset int64
+	Length int64
+}
+
+type ListObjectsOptions struct {
+	Prefix string
+	// continue listing after Marker, which is the NextMarker of last page
+	Marker  string
+	MaxKeys int
+}
+
+type ListObjectsInfo struct {
+	Objects     []ObjectInfo
+	IsTruncated bool
+	NextMarker  string
+}
+
+const defaultMaxKeys = 1000
+
+// paginate lists a page of objs by their names for backends which can only
+// list all objects at once
+func paginate(objs []ObjectInfo, opts ListObjectsOptions) ListObjectsInfo {
+	maxKeys := opts.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].Name < objs[j].Name
+	})
+
+	var loi ListObjectsInfo
+	for _, oi := range objs {
+		if oi.Name <= opts.Marker || !strings.HasPrefix(oi.Name, opts.Prefix) {
+			continue
+		}
+		if len(loi.Objects) == maxKeys {
+			loi.IsTruncated = true
+			loi.NextMarker = loi.Objects[maxKeys-1].Name
+			break
+		}
+		loi.Objects = append(loi.Objects, oi)
+	}
+	return loi
+}
+
+// Range resolves the byte range selected by opts in an object of size bytes
+func (o ObjectOptions) Range(size int64) (start int64, length int64, err error) {
+	if o.Offset < 0 || o.Length < 0 || o.Offset > size {
+		return 0, 0, logs.StorageError{Message: fmt.Sprintf("range %d+%d is out of object size %d", o.Offset, o.Length, size)}
+	}
+	length = size - o.Offset
+	if o.Length > 0 && o.Length < length {
+		length = o.Length
+	}
+	return o.Offset, length, nil
+}
+
+type StorageType uint8
+
+const (
+	MEFS StorageType = iota
+	IPFS
+	QINIU
+	LOCAL
+	S3
+	REPLICA
+)
+
+func (s StorageType) String() string {
+	switch s {
+	case MEFS:
+		return "mefs"
+	case IPFS:
+		return "ipfs"
+	case QINIU:
+		return "qiniu"
+	case LOCAL:
+		return "local"
+	case S3:
+		return "s3"
+	case REPLICA:
+		return "replica"
+	default:
+		return "unknow storage"
+	}
+}
+
+func StringToStorageType(s string) StorageType {
+	storage := new(big.Int)
+	storage.SetString(s, 10)
+	return StorageType(storage.Uint64())
+}
+
+func Uint8ToStorageType(s uint8) StorageType {
+	return StorageType(s)
+}
+
+// ParseStorageType resolves a storage name as printed by StorageType.String
+func ParseStorageType(s string) (StorageType, error) {
+	for _, st := range []StorageType{MEFS, IPFS, QINIU, LOCAL, S3, REPLICA} {
+		if strings.EqualFold(s, st.String()) {
+			return st, nil
+		}
+	}
+	return 0, logs.StorageNotSupport{}
+}
+
+func (s StorageType) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *StorageType) UnmarshalText(text []byte) error {
+	st, err := ParseStorageType(string(text))
+	if err != nil {
+		return err
+	}
+	*s = st
+	return nil
+}
+
+// Config describes which backend a node keeps its blobs in
+type Config struct {
+	Name string
+	Type StorageType
+
+	// mefs user api and token, empty api means reading them from MEFS_PATH;
+	// for ipfs, Api is the address of the kubo rpc api;
+	// for s3 and qiniu, Api is the endpoint of the s3 compatible service
+	Api   string
+	Token string
+
+	// credentials of s3 compatible services
+	AccessKey string
+	SecretKey string
+	Region    string
+
+	// root directory of the local backend
+	Path string
+
+	// backends of the replicated storage and how many of them must be
+	// written before a put succeeds
+	Replicas []Config
+	Quorum   int
+}
@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	objs := func(names ...string) []ObjectInfo {
+		var objs []ObjectInfo
+		for _, name := range names {
+			objs = append(objs, ObjectInfo{Name: name})
+		}
+		return objs
+	}
+	names := func(loi ListObjectsInfo) []string {
+		var names []string
+		for _, oi := range loi.Objects {
+			names = append(names, oi.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name      string
+		objs      []ObjectInfo
+		opts      ListObjectsOptions
+		want      []string
+		truncated bool
+		next      string
+	}{
+		{"empty", nil, ListObjectsOptions{}, nil, false, ""},
+		{"sorted", objs("c", "a", "b"), ListObjectsOptions{}, []string{"a", "b", "c"}, false, ""},
+		{"prefix", objs("da-1", "ns/1", "da-2"), ListObjectsOptions{Prefix: "da-"}, []string{"da-1", "da-2"}, false, ""},
+		{"first page", objs("a", "b", "c"), ListObjectsOptions{MaxKeys: 2}, []string{"a", "b"}, true, "b"},
+		{"last page", objs("a", "b", "c"), ListObjectsOptions{MaxKeys: 2, Marker: "b"}, []string{"c"}, false, ""},
+		{"exact page", objs("a", "b"), ListObjectsOptions{MaxKeys: 2}, []string{"a", "b"}, false, ""},
+		{"marker after all", objs("a", "b"), ListObjectsOptions{Marker: "b"}, nil, false, ""},
+		{"prefix and marker", objs("da-1", "da-2", "da-3", "x"), ListObjectsOptions{Prefix: "da-", Marker: "da-1", MaxKeys: 1}, []string{"da-2"}, true, "da-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loi := paginate(tt.objs, tt.opts)
+			if got := names(loi); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("objects = %v, want %v", got, tt.want)
+			}
+			if loi.IsTruncated != tt.truncated || loi.NextMarker != tt.next {
+				t.Errorf("truncated = %v, next = %q, want %v, %q", loi.IsTruncated, loi.NextMarker, tt.truncated, tt.next)
+			}
+		})
+	}
+}
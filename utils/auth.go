@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/memoio/meeda-node/logs"
+)
+
+// headers of the signed requests
+const (
+	HeaderAddress   = "X-Meeda-Address"
+	HeaderTimestamp = "X-Meeda-Timestamp"
+	HeaderSignature = "X-Meeda-Signature"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request does
+// not carry its kind of credentials
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator checks the credentials of a request, and returns the
+// address of the requester, which is the zero address if the credentials
+// are not bound to an address. The errors other than ErrNoCredentials are
+// logs errors.
+type Authenticator interface {
+	Authenticate(r *http.Request) (common.Address, error)
+}
+
+// AnyOf accepts the requests accepted by the first Authenticator whose
+// credentials they carry
+type AnyOf []Authenticator
+
+func (a AnyOf) Authenticate(r *http.Request) (common.Address, error) {
+	for _, auth := range a {
+		addr, err := auth.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return addr, err
+	}
+	return common.Address{}, logs.AuthenticationFailed{Message: "credentials are not set"}
+}
+
+// APIKeys accepts the requests with one of the static keys in the header
+// "Authorization: Bearer <key>" or "X-API-Key: <key>"
+type APIKeys []string
+
+func (keys APIKeys) Authenticate(r *http.Request) (common.Address, error) {
+	key := APIKeyOf(r)
+	if key == "" {
+		return common.Address{}, ErrNoCredentials
+	}
+
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return common.Address{}, nil
+		}
+	}
+	return common.Address{}, logs.AuthenticationFailed{Message: "api key is not accepted"}
+}
+
+// APIKeyOf returns the api key of the request, empty if it is not set
+func APIKeyOf(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return key
+}
+
+// SignedRequests accepts the requests signed by the EIP-191 signature of
+// RequestMessage, in the headers X-Meeda-Address, X-Meeda-Timestamp and
+// X-Meeda-Signature. The timestamp should be within Window of now, and the
+// address should be in Allowed unless it is empty. The body is hashed before
+// the signature is checked, so it is at most MaxBody bytes unless MaxBody is
+// 0. A request is accepted only once if Replays is set.
+type SignedRequests struct {
+	Window  time.Duration
+	Allowed map[common.Address]bool
+	MaxBody int64
+	Replays *Replays
+}
+
+// Replays remembers the signed requests accepted until their timestamps
+// fall out of the window
+type Replays struct {
+	lk     sync.Mutex
+	seen   map[[32]byte]time.Time
+	pruned time.Time
+}
+
+// accept reports whether the request key is not seen before, and remembers
+// it until expire
+func (r *Replays) accept(key [32]byte, expire time.Time) bool {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	now := time.Now()
+	if r.seen == nil {
+		r.seen = make(map[[32]byte]time.Time)
+	}
+	if now.Sub(r.pruned) > time.Minute {
+		for k, e := range r.seen {
+			if now.After(e) {
+				delete(r.seen, k)
+			}
+		}
+		r.pruned = now
+	}
+
+	if e, ok := r.seen[key]; ok && !now.After(e) {
+		return false
+	}
+	r.seen[key] = expire
+	return true
+}
+
+// RequestMessage is the message signed for a request, the body is hashed by
+// keccak256
+func RequestMessage(method, uri string, timestamp int64, bodyHash []byte) []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%d\n0x%s", method, uri, timestamp, hex.EncodeToString(bodyHash)))
+}
+
+// SignRequest signs a request whose body is hashed to bodyHash with sk, the
+// headers of the signature are set on r. It is used by the clients of the
+// signed requests.
+func SignRequest(r *http.Request, bodyHash []byte, sk *ecdsa.PrivateKey) error {
+	timestamp := time.Now().Unix()
+	msg := RequestMessage(r.Method, r.URL.RequestURI(), timestamp, bodyHash)
+	sig, err := crypto.Sign(accounts.TextHash(msg), sk)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set(HeaderAddress, crypto.PubkeyToAddress(sk.PublicKey).Hex())
+	r.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	r.Header.Set(HeaderSignature, hexutil.Encode(sig))
+	return nil
+}
+
+func (s *SignedRequests) Authenticate(r *http.Request) (common.Address, error) {
+	addrHex := r.Header.Get(HeaderAddress)
+	sigHex := r.Header.Get(HeaderSignature)
+	if addrHex == "" && sigHex == "" {
+		return common.Address{}, ErrNoCredentials
+	}
+	if !common.IsHexAddress(addrHex) {
+		return common.Address{}, logs.AuthenticationFailed{Message: HeaderAddress + " is not a legal address"}
+	}
+	addr := common.HexToAddress(addrHex)
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return addr, logs.AuthenticationFailed{Message: HeaderTimestamp + " is not a legal unix time"}
+	}
+	skew := time.Since(time.Unix(timestamp, 0))
+	if skew > s.Window || skew < -s.Window {
+		return addr, logs.AuthenticationFailed{Message: "the request is signed too long ago or too far in the future"}
+	}
+
+	sig, err := hex.DecodeString(strings.TrimPrefix(sigHex, "0x"))
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return addr, logs.AuthenticationFailed{Message: HeaderSignature + " is not a legal signature"}
+	}
+	// wallets set v to 27 or 28
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	bodyHash, err := hashBody(r, s.MaxBody)
+	if _, ok := err.(logs.DataTooLarge); ok {
+		return addr, err
+	}
+	if err != nil {
+		return addr, logs.AuthenticationFailed{Message: "read body: " + err.Error()}
+	}
+
+	msg := RequestMessage(r.Method, r.URL.RequestURI(), timestamp, bodyHash)
+	pub, err := crypto.SigToPub(accounts.TextHash(msg), sig)
+	if err != nil || crypto.PubkeyToAddress(*pub) != addr {
+		return addr, logs.AuthenticationFailed{Message: "signature is not signed by " + addr.Hex()}
+	}
+
+	if len(s.Allowed) > 0 && !s.Allowed[addr] {
+		return addr, logs.AuthenticationFailed{Message: addr.Hex() + " is not allowed"}
+	}
+
+	// the signature may be malleated, so the signed message is remembered
+	if s.Replays != nil {
+		var key [32]byte
+		copy(key[:], crypto.Keccak256(addr.Bytes(), msg))
+		if !s.Replays.accept(key, time.Unix(timestamp, 0).Add(s.Window)) {
+			return addr, logs.AuthenticationFailed{Message: "the request is replayed"}
+		}
+	}
+	return addr, nil
+}
+
+// hashBody hashes the body of r, which is staged in a temporary file and
+// replaced by it. The file is removed when the body is closed.
+func hashBody(r *http.Request, limit int64) ([]byte, error) {
+	hasher := crypto.NewKeccakState()
+	if r.Body == nil || r.Body == http.NoBody {
+		return hasher.Sum(nil), nil
+	}
+
+	file, err := os.CreateTemp("", "meeda-body-")
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader = r.Body
+	if limit > 0 {
+		body = io.LimitReader(r.Body, limit+1)
+	}
+	n, err := io.Copy(io.MultiWriter(file, hasher), body)
+	r.Body.Close()
+	if err == nil && limit > 0 && n > limit {
+		err = logs.DataTooLarge{Size: -1, Limit: limit}
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	r.Body = &tempBody{file}
+	return hasher.Sum(nil), nil
+}
+
+type tempBody struct {
+	*os.File
+}
+
+func (b *tempBody) Close() error {
+	b.File.Close()
+	return os.Remove(b.Name())
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/memoio/meeda-node/logs"
+)
+
+func TestSignedRequests(t *testing.T) {
+	sk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(sk.PublicKey)
+	body := []byte("data")
+	replays := new(Replays)
+
+	signed := func(body []byte) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/putObject?from=x", bytes.NewReader(body))
+		err := SignRequest(r, crypto.Keccak256(body), sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		auth    SignedRequests
+		request func() *http.Request
+		// nil for accepted
+		err error
+	}{
+		{
+			name:    "signed",
+			auth:    SignedRequests{Window: time.Minute},
+			request: func() *http.Request { return signed(body) },
+		},
+		{
+			name:    "allowed",
+			auth:    SignedRequests{Window: time.Minute, Allowed: map[common.Address]bool{addr: true}},
+			request: func() *http.Request { return signed(body) },
+		},
+		{
+			name: "wallet recovery id",
+			auth: SignedRequests{Window: time.Minute},
+			request: func() *http.Request {
+				r := signed(body)
+				sig := hexutil.MustDecode(r.Header.Get(HeaderSignature))
+				sig[crypto.RecoveryIDOffset] += 27
+				r.Header.Set(HeaderSignature, hexutil.Encode(sig))
+				return r
+			},
+		},
+		{
+			name: "no credentials",
+			auth: SignedRequests{Window: time.Minute},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/putObject", bytes.NewReader(body))
+			},
+			err: ErrNoCredentials,
+		},
+		{
+			name: "illegal address",
+			auth: SignedRequests{Window: time.Minute},
+			request: func() *http.Request {
+				r := signed(body)
+				r.Header.Set(HeaderAddress, "0x1234")
+				return r
+			},
+			err: logs.AuthenticationFailed{},
+		},
+		{
+			name: "other signer",
+			auth: SignedRequests{Window: time.Minute},
+			request: func() *http.Request {
+				r := signed(body)
+				r.Header.Set(HeaderAddress, crypto.PubkeyToAddress(other.PublicKey).Hex())
+				return r
+			},
+			err: logs.AuthenticationFailed{},
+		},
+		{
+			name: "tampered body",
+			auth: SignedRequests{Window: time.Minute},
+			request: func() *http.Request {
+				r := signed(body)
+				r.Body = io.NopCloser(bytes.NewReader([]byte("other")))
+				return r
+			},
+			err: logs.AuthenticationFailed{},
+		},
+		{
+			name: "tampered uri",
+			auth: SignedRequests{Window: time.Minute},
+			request: func() *http.Request {
+				r := signed(body)
+				r.URL.RawQuery = "from=y"
+				return r
+			},
+			err: logs.AuthenticationFailed{},
+		},
+		{
+			name: "expired",
+			auth: SignedRequests{Window: time.Minute},
+			request: func() *http.Request {
+				r := signed(body)
+				r.Header.Set(HeaderTimestamp, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+				return r
+			},
+			err: logs.AuthenticationFailed{},
+		},
+		{
+			name:    "not allowed",
+			auth:    SignedRequests{Window: time.Minute, Allowed: map[common.Address]bool{crypto.PubkeyToAddress(other.PublicKey): true}},
+			request: func() *http.Request { return signed(body) },
+			err:     logs.AuthenticationFailed{},
+		},
+		{
+			name: "replayed",
+			auth: SignedRequests{Window: time.Minute, Replays: replays},
+			request: func() *http.Request {
+				r := signed(body)
+				replayed := r.Clone(r.Context())
+				replayed.Body = io.NopCloser(bytes.NewReader(body))
+				_, err := (&SignedRequests{Window: time.Minute, Replays: replays}).Authenticate(replayed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return r
+			},
+			err: logs.AuthenticationFailed{},
+		},
+		{
+			name:    "body too large",
+			auth:    SignedRequests{Window: time.Minute, MaxBody: 2},
+			request: func() *http.Request { return signed(body) },
+			err:     logs.DataTooLarge{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.request()
+			got, err := tt.auth.Authenticate(r)
+			switch want := tt.err.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("rejected: %s", err)
+				}
+				if got != addr {
+					t.Fatalf("address = %s, want %s", got.Hex(), addr.Hex())
+				}
+				// the body is still readable after it is hashed
+				data, err := io.ReadAll(r.Body)
+				if err != nil || !bytes.Equal(data, body) {
+					t.Fatalf("body = %q, %v", data, err)
+				}
+				r.Body.Close()
+			case logs.AuthenticationFailed:
+				if _, ok := err.(logs.AuthenticationFailed); !ok {
+					t.Fatalf("err = %v, want %T", err, want)
+				}
+			case logs.DataTooLarge:
+				if _, ok := err.(logs.DataTooLarge); !ok {
+					t.Fatalf("err = %v, want %T", err, want)
+				}
+			default:
+				if err != want {
+					t.Fatalf("err = %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
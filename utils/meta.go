@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/memoio/meeda-node/logs"
+)
+
+// headers of the metadata of objects
+const (
+	HeaderContentType = "X-Meeda-Content-Type"
+	HeaderFilename    = "X-Meeda-Filename"
+	HeaderTags        = "X-Meeda-Tags"
+	HeaderNamespace   = "X-Meeda-Namespace"
+	HeaderEncoding    = "X-Meeda-Encoding"
+	HeaderManifest    = "X-Meeda-Manifest"
+)
+
+const maxMetaSize = 2048
+const maxTags = 32
+const maxNamespaceLen = 64
+
+// ObjectMeta is the metadata attached to an object by its uploader
+type ObjectMeta struct {
+	ContentType string            `json:"contentType,omitempty"`
+	Filename    string            `json:"filename,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	// namespace of the rollup, which the object is listed in
+	Namespace string `json:"namespace,omitempty"`
+	// how the object is split into field elements, see SplitDataAs
+	Encoding string `json:"encoding,omitempty"`
+	// the object is the manifest of a large object put by a light node,
+	// which is not taken from the fields of the clients
+	Manifest bool `json:"manifest,omitempty"`
+}
+
+// MetaFromFields takes the metadata from the fields of an upload, which are
+// "content-type", "filename", "tags" as a json object of strings,
+// "namespace" and "encoding"
+func MetaFromFields(fields map[string]string) (ObjectMeta, error) {
+	meta := ObjectMeta{
+		ContentType: fields["content-type"],
+		Filename:    path.Base("/" + fields["filename"]),
+		Namespace:   fields["namespace"],
+		Encoding:    fields["encoding"],
+	}
+	if meta.Filename == "/" {
+		meta.Filename = ""
+	}
+	// the default type of clients tells nothing, so it is sniffed instead
+	if meta.ContentType == "application/octet-stream" {
+		meta.ContentType = ""
+	}
+
+	if tags := fields["tags"]; tags != "" {
+		err := json.Unmarshal([]byte(tags), &meta.Tags)
+		if err != nil {
+			return meta, logs.ServerError{Message: "field 'tags' is not a json object of strings"}
+		}
+	}
+
+	return meta, meta.Validate()
+}
+
+func (m ObjectMeta) Validate() error {
+	if m.Namespace != "" && !ValidNamespace(m.Namespace) {
+		return logs.ServerError{Message: "namespace " + m.Namespace + " is illegal"}
+	}
+	if !ValidEncoding(m.Encoding) {
+		return logs.ServerError{Message: "encoding " + m.Encoding + " is not supported"}
+	}
+	if m.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(m.ContentType); err != nil {
+			return logs.ServerError{Message: "content type " + m.ContentType + " is illegal"}
+		}
+	}
+	if len(m.Tags) > maxTags {
+		return logs.ServerError{Message: "too many tags"}
+	}
+	size := len(m.ContentType) + len(m.Filename)
+	for k, v := range m.Tags {
+		size += len(k) + len(v)
+	}
+	if size > maxMetaSize {
+		return logs.DataTooLarge{Size: int64(size), Limit: maxMetaSize}
+	}
+	return nil
+}
+
+// ValidNamespace reports whether ns is at most 64 letters, digits, '.', '-'
+// and '_', and is not "." or ".."
+func ValidNamespace(ns string) bool {
+	if ns == "" || len(ns) > maxNamespaceLen || ns == "." || ns == ".." {
+		return false
+	}
+	for _, r := range ns {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEmpty reports whether the object has no metadata other than namespace
+// and encoding
+func (m ObjectMeta) IsEmpty() bool {
+	return m.ContentType == "" && m.Filename == "" && len(m.Tags) == 0
+}
+
+// Fields returns the metadata as the fields of an upload
+func (m ObjectMeta) Fields() map[string]string {
+	fields := make(map[string]string)
+	if m.ContentType != "" {
+		fields["content-type"] = m.ContentType
+	}
+	if m.Filename != "" {
+		fields["filename"] = m.Filename
+	}
+	if len(m.Tags) > 0 {
+		tags, _ := json.Marshal(m.Tags)
+		fields["tags"] = string(tags)
+	}
+	if m.Namespace != "" {
+		fields["namespace"] = m.Namespace
+	}
+	if m.Encoding != "" {
+		fields["encoding"] = m.Encoding
+	}
+	if m.Manifest {
+		fields["manifest"] = "true"
+	}
+	return fields
+}
+
+// ResolveContentType returns the content type of the uploader, or the one
+// of the extension of the filename, or the one sniffed from data
+func (m ObjectMeta) ResolveContentType(data []byte) string {
+	if m.ContentType != "" {
+		return m.ContentType
+	}
+	if ext := path.Ext(m.Filename); ext != "" {
+		if contentType := TypeByExtension(ext); contentType != TypeByExtension("") {
+			return contentType
+		}
+	}
+	return http.DetectContentType(data)
+}
+
+// SetHeaders sets the metadata in the response headers, data is sniffed if
+// the content type is unknown
+func (m ObjectMeta) SetHeaders(h http.Header, data []byte) {
+	contentType := m.ResolveContentType(data)
+	h.Set("Content-Type", contentType)
+	// the browsers take the content type as it is, and the content set by
+	// the uploaders runs no script in the origin of the node
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "sandbox")
+	if m.ContentType != "" {
+		h.Set(HeaderContentType, m.ContentType)
+	}
+	disposition := "attachment"
+	if passiveContentType(contentType) {
+		disposition = "inline"
+	}
+	if m.Filename != "" {
+		h.Set(HeaderFilename, url.QueryEscape(m.Filename))
+		h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": m.Filename}))
+	} else {
+		h.Set("Content-Disposition", disposition)
+	}
+	if len(m.Tags) > 0 {
+		tags := make(url.Values)
+		for k, v := range m.Tags {
+			tags.Set(k, v)
+		}
+		h.Set(HeaderTags, tags.Encode())
+	}
+	if m.Namespace != "" {
+		h.Set(HeaderNamespace, m.Namespace)
+	}
+	if m.Encoding != "" {
+		h.Set(HeaderEncoding, m.Encoding)
+	}
+	if m.Manifest {
+		h.Set(HeaderManifest, "true")
+	}
+}
+
+// passiveContentType tells whether the browsers display the content of
+// contentType without running scripts, the others are downloaded
+func passiveContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "text/plain", "application/json", "application/octet-stream",
+		"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif", "image/bmp":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/")
+}
+
+// MetaFromHeaders takes the metadata set by SetHeaders
+func MetaFromHeaders(h http.Header) ObjectMeta {
+	meta := ObjectMeta{
+		ContentType: h.Get(HeaderContentType),
+		Namespace:   h.Get(HeaderNamespace),
+		Encoding:    h.Get(HeaderEncoding),
+		Manifest:    h.Get(HeaderManifest) == "true",
+	}
+	meta.Filename, _ = url.QueryUnescape(h.Get(HeaderFilename))
+	if tags, err := url.ParseQuery(h.Get(HeaderTags)); err == nil && len(tags) > 0 {
+		meta.Tags = make(map[string]string)
+		for k := range tags {
+			meta.Tags[k] = tags.Get(k)
+		}
+	}
+	return meta
+}
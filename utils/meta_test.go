@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMetaFromFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   ObjectMeta
+		fails  bool
+	}{
+		{"empty", map[string]string{}, ObjectMeta{}, false},
+		{"content type", map[string]string{"content-type": "text/plain; charset=utf-8"}, ObjectMeta{ContentType: "text/plain; charset=utf-8"}, false},
+		{"octet stream is sniffed", map[string]string{"content-type": "application/octet-stream"}, ObjectMeta{}, false},
+		{"illegal content type", map[string]string{"content-type": "text/"}, ObjectMeta{}, true},
+		{"filename", map[string]string{"filename": "a.json"}, ObjectMeta{Filename: "a.json"}, false},
+		{"filename with dirs", map[string]string{"filename": "../../etc/passwd"}, ObjectMeta{Filename: "passwd"}, false},
+		{"filename of root", map[string]string{"filename": "/"}, ObjectMeta{}, false},
+		{"tags", map[string]string{"tags": `{"k":"v"}`}, ObjectMeta{Tags: map[string]string{"k": "v"}}, false},
+		{"tags not of strings", map[string]string{"tags": `{"k":1}`}, ObjectMeta{}, true},
+		{"tags not an object", map[string]string{"tags": `["k"]`}, ObjectMeta{}, true},
+		{"too many tags", map[string]string{"tags": manyTags(maxTags + 1)}, ObjectMeta{}, true},
+		{"too large", map[string]string{"filename": strings.Repeat("a", maxMetaSize+1)}, ObjectMeta{}, true},
+		{"namespace", map[string]string{"namespace": "rollup-1"}, ObjectMeta{Namespace: "rollup-1"}, false},
+		{"illegal namespace", map[string]string{"namespace": "a/b"}, ObjectMeta{}, true},
+		{"unknown encoding", map[string]string{"encoding": "unknown"}, ObjectMeta{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MetaFromFields(tt.fields)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("accepted %v", tt.fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rejected: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("meta = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func manyTags(n int) string {
+	tags := make([]string, n)
+	for i := range tags {
+		tags[i] = `"k` + strings.Repeat("k", i) + `":"v"`
+	}
+	return "{" + strings.Join(tags, ",") + "}"
+}
+
+func TestValidNamespace(t *testing.T) {
+	tests := []struct {
+		ns   string
+		want bool
+	}{
+		{"rollup-1", true},
+		{"Rollup_1.v2", true},
+		{"0a1b2c", true},
+		{strings.Repeat("a", maxNamespaceLen), true},
+		{strings.Repeat("a", maxNamespaceLen+1), false},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"...", true},
+		{"a/b", false},
+		{"a b", false},
+		{"a%2fb", false},
+		{"名字", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidNamespace(tt.ns); got != tt.want {
+			t.Errorf("ValidNamespace(%q) = %v, want %v", tt.ns, got, tt.want)
+		}
+	}
+}
+
+func TestSetHeadersDisposition(t *testing.T) {
+	tests := []struct {
+		name        string
+		meta        ObjectMeta
+		data        string
+		disposition string
+	}{
+		{"html is downloaded", ObjectMeta{ContentType: "text/html"}, "<script>alert(1)</script>", "attachment"},
+		{"sniffed html is downloaded", ObjectMeta{}, "<html><script>alert(1)</script></html>", "attachment"},
+		{"svg is downloaded", ObjectMeta{Filename: "a.svg"}, "<svg></svg>", `attachment; filename=a.svg`},
+		{"text is inline", ObjectMeta{ContentType: "text/plain; charset=utf-8"}, "data", "inline"},
+		{"png is inline", ObjectMeta{Filename: "a.png"}, "\x89PNG", `inline; filename=a.png`},
+		{"illegal content type is downloaded", ObjectMeta{ContentType: "text/"}, "data", "attachment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := make(http.Header)
+			tt.meta.SetHeaders(h, []byte(tt.data))
+			if got := h.Get("Content-Disposition"); got != tt.disposition {
+				t.Fatalf("Content-Disposition = %q, want %q", got, tt.disposition)
+			}
+			if got := h.Get("Content-Security-Policy"); got != "sandbox" {
+				t.Fatalf("Content-Security-Policy = %q", got)
+			}
+		})
+	}
+}
@@ -1,65 +1,181 @@
-package utils
-
-import "github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
-
-const ShardingLen = 127
-
-func Pad127(in []byte, res []fr.Element) {
-	if len(in) != 127 {
-		if len(in) > 127 {
-			in = in[:127]
-		} else {
-			padding := make([]byte, 127-len(in))
-			in = append(in, padding...)
-		}
-	}
-
-	tmp := make([]byte, 32)
-	copy(tmp[:31], in[:31])
-
-	t := in[31] >> 6
-	tmp[31] = in[31] & 0x3f
-	res[0].SetBytes(tmp)
-
-	var v byte
-	for i := 32; i < 64; i++ {
-		v = in[i]
-		tmp[i-32] = (v << 2) | t
-		t = v >> 6
-	}
-	t = v >> 4
-	tmp[31] &= 0x3f
-	res[1].SetBytes(tmp)
-
-	for i := 64; i < 96; i++ {
-		v = in[i]
-		tmp[i-64] = (v << 4) | t
-		t = v >> 4
-	}
-	t = v >> 2
-	tmp[31] &= 0x3f
-	res[2].SetBytes(tmp)
-
-	for i := 96; i < 127; i++ {
-		v = in[i]
-		tmp[i-96] = (v << 6) | t
-		t = v >> 2
-	}
-	tmp[31] = t & 0x3f
-	res[3].SetBytes(tmp)
-}
-
-func SplitData(data []byte) []fr.Element {
-	num := (len(data)-1)/ShardingLen + 1
-
-	atom := make([]fr.Element, num*4)
-
-	padding := make([]byte, ShardingLen*num-len(data))
-	data = append(data, padding...)
-
-	for i := 0; i < num; i++ {
-		Pad127(data[ShardingLen*i:ShardingLen*(i+1)], atom[4*i:4*i+4])
-	}
-
-	return atom
-}
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/memoio/meeda-node/logs"
+)
+
+const ShardingLen = 127
+
+func Pad127(in []byte, res []fr.Element) {
+	if len(in) != 127 {
+		if len(in) > 127 {
+			in = in[:127]
+		} else {
+			padding := make([]byte, 127-len(in))
+			in = append(in, padding...)
+		}
+	}
+
+	tmp := make([]byte, 32)
+	copy(tmp[:31], in[:31])
+
+	t := in[31] >> 6
+	tmp[31] = in[31] & 0x3f
+	res[0].SetBytes(tmp)
+
+	var v byte
+	for i := 32; i < 64; i++ {
+		v = in[i]
+		tmp[i-32] = (v << 2) | t
+		t = v >> 6
+	}
+	t = v >> 4
+	tmp[31] &= 0x3f
+	res[1].SetBytes(tmp)
+
+	for i := 64; i < 96; i++ {
+		v = in[i]
+		tmp[i-64] = (v << 4) | t
+		t = v >> 4
+	}
+	t = v >> 2
+	tmp[31] &= 0x3f
+	res[2].SetBytes(tmp)
+
+	for i := 96; i < 127; i++ {
+		v = in[i]
+		tmp[i-96] = (v << 6) | t
+		t = v >> 2
+	}
+	tmp[31] = t & 0x3f
+	res[3].SetBytes(tmp)
+}
+
+// MaxDataSize returns how many bytes can be committed with an SRS of
+// srsSize points, every 127 bytes are split into 4 elements
+func MaxDataSize(srsSize int) int64 {
+	return int64(srsSize/4) * ShardingLen
+}
+
+func SplitData(data []byte) []fr.Element {
+	num := (len(data)-1)/ShardingLen + 1
+
+	atom := make([]fr.Element, num*4)
+
+	padding := make([]byte, ShardingLen*num-len(data))
+	data = append(data, padding...)
+
+	for i := 0; i < num; i++ {
+		Pad127(data[ShardingLen*i:ShardingLen*(i+1)], atom[4*i:4*i+4])
+	}
+
+	return atom
+}
+
+// the encodings of data into field elements
+const (
+	// EncodingMeeda packs every 127 bytes into 4 elements by Pad127
+	EncodingMeeda = ""
+	// EncodingEIP4844 puts every 31 bytes into an element whose top byte is
+	// zero, padded to the 4096 elements of a blob. The elements are the ones
+	// of EIP-4844. Meeda commits to them as coefficients with its own SRS on
+	// chain, and BlobCommitment is the commitment of Ethereum to the blob,
+	// whose versioned hash is the one of the object.
+	EncodingEIP4844 = "eip4844"
+)
+
+const BlobElements = 4096
+const BlobElementLen = 31
+
+// MaxBlobDataSize is how many bytes a blob of EIP-4844 holds
+const MaxBlobDataSize = BlobElements * BlobElementLen
+
+func ValidEncoding(encoding string) bool {
+	return encoding == EncodingMeeda || encoding == EncodingEIP4844
+}
+
+// SplitBlob splits data into the elements of an EIP-4844 blob, data is at
+// most MaxBlobDataSize bytes
+func SplitBlob(data []byte) []fr.Element {
+	num := (len(data)-1)/BlobElementLen + 1
+	if num < BlobElements {
+		num = BlobElements
+	}
+
+	atom := make([]fr.Element, num)
+	tmp := make([]byte, 32)
+	for i := 0; i*BlobElementLen < len(data); i++ {
+		end := (i + 1) * BlobElementLen
+		if end > len(data) {
+			end = len(data)
+		}
+		for j := range tmp {
+			tmp[j] = 0
+		}
+		copy(tmp[1:], data[i*BlobElementLen:end])
+		atom[i].SetBytes(tmp)
+	}
+
+	return atom
+}
+
+// EncodeBlob puts data into an EIP-4844 blob, whose elements are the ones
+// of SplitBlob as 32 bytes big endian
+func EncodeBlob(data []byte) (*kzg4844.Blob, error) {
+	if len(data) > MaxBlobDataSize {
+		return nil, logs.DataTooLarge{Size: int64(len(data)), Limit: MaxBlobDataSize}
+	}
+	var blob kzg4844.Blob
+	for i := 0; i*BlobElementLen < len(data); i++ {
+		end := (i + 1) * BlobElementLen
+		if end > len(data) {
+			end = len(data)
+		}
+		copy(blob[i*32+1:], data[i*BlobElementLen:end])
+	}
+	return &blob, nil
+}
+
+// BlobCommitment is the commitment of data in EncodingEIP4844, which is
+// blob_to_kzg_commitment of EIP-4844 with the trusted setup of Ethereum
+func BlobCommitment(data []byte) ([48]byte, error) {
+	blob, err := EncodeBlob(data)
+	if err != nil {
+		return [48]byte{}, err
+	}
+	commit, err := kzg4844.BlobToCommitment(*blob)
+	return commit, err
+}
+
+// SplitDataAs splits data into elements in the encoding
+func SplitDataAs(encoding string, data []byte) []fr.Element {
+	if encoding == EncodingEIP4844 {
+		return SplitBlob(data)
+	}
+	return SplitData(data)
+}
+
+// VersionedHash is the versioned hash of EIP-4844 of the 48 bytes of a
+// commitment, which is 0x01 || sha256(commitment)[1:]
+func VersionedHash(commitBytes []byte) [32]byte {
+	h := sha256.Sum256(commitBytes)
+	h[0] = 0x01
+	return h
+}
+
+// ParseVersionedHash decodes the hex of a versioned hash with or without 0x
+func ParseVersionedHash(s string) ([32]byte, bool) {
+	var h [32]byte
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != 32 || b[0] != 0x01 {
+		return h, false
+	}
+	copy(h[:], b)
+	return h, true
+}
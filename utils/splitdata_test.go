@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+)
+
+// the blobs of blob_to_kzg_commitment of the consensus specs for mainnet
+// whose elements have zero top bytes, with their commitments and versioned
+// hashes
+var blobVectors = []struct {
+	name          string
+	data          func() []byte
+	commitment    string
+	versionedHash string
+}{
+	{
+		name:          "empty blob",
+		data:          func() []byte { return nil },
+		commitment:    "c00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		versionedHash: "010657f37554c781402a22917dee2f75def7ab966d7b770905398eba3c444014",
+	},
+	{
+		// blob_to_kzg_commitment_case_valid_blob_19b3f3f8c98ea31e
+		name: "element 3211 is 1",
+		data: func() []byte {
+			data := make([]byte, 3212*BlobElementLen)
+			data[len(data)-1] = 1
+			return data
+		},
+		commitment:    "93efc82d2017e9c57834a1246463e64774e56183bb247c8fc9dd98c56817e878d97b05f5c8d900acf1fbbbca6f146556",
+		versionedHash: "01ad7666ef9d8f53b5adf54f029b13b6f171b1d0bd346a2ede315d3e243484ef",
+	},
+	{
+		// blob_to_kzg_commitment_case_valid_blob_a87a4e636e0f58fb
+		name: "all elements are 2",
+		data: func() []byte {
+			data := make([]byte, MaxBlobDataSize)
+			for i := BlobElementLen - 1; i < len(data); i += BlobElementLen {
+				data[i] = 2
+			}
+			return data
+		},
+		commitment:    "a572cbea904d67468808c8eb50a9450c9721db309128012543902d0ac358a62ae28f75bb8f1c7c42c39a8c5529bf0f4e",
+		versionedHash: "01cf45213dd7b4716864d378f3c6d861467987e4d94b7f79a1f814a697e38637",
+	},
+}
+
+func TestBlobCommitment(t *testing.T) {
+	for _, tt := range blobVectors {
+		t.Run(tt.name, func(t *testing.T) {
+			commit, err := BlobCommitment(tt.data())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(commit[:]); got != tt.commitment {
+				t.Fatalf("commitment = %s, want %s", got, tt.commitment)
+			}
+			versionedHash := VersionedHash(commit[:])
+			if got := hex.EncodeToString(versionedHash[:]); got != tt.versionedHash {
+				t.Fatalf("versioned hash = %s, want %s", got, tt.versionedHash)
+			}
+		})
+	}
+
+	_, err := BlobCommitment(make([]byte, MaxBlobDataSize+1))
+	if err == nil {
+		t.Fatal("committed to data larger than a blob")
+	}
+}
+
+func TestSplitBlobMatchesEncodeBlob(t *testing.T) {
+	sizes := []int{0, 1, BlobElementLen - 1, BlobElementLen, BlobElementLen + 1, 1000, MaxBlobDataSize}
+
+	for _, size := range sizes {
+		data := bytes.Repeat([]byte{0xff}, size)
+		elements := SplitBlob(data)
+		if len(elements) != BlobElements {
+			t.Fatalf("%d bytes are split into %d elements", size, len(elements))
+		}
+		blob, err := EncodeBlob(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range elements {
+			var e fr.Element
+			e.SetBytes(blob[i*32 : i*32+32])
+			if !e.Equal(&elements[i]) {
+				t.Fatalf("element %d of %d bytes differs", i, size)
+			}
+		}
+	}
+}
+
+func TestParseVersionedHash(t *testing.T) {
+	const h = "010657f37554c781402a22917dee2f75def7ab966d7b770905398eba3c444014"
+	tests := []struct {
+		s  string
+		ok bool
+	}{
+		{h, true},
+		{"0x" + h, true},
+		{"02" + h[2:], false},
+		{h[:62], false},
+		{h + "00", false},
+		{"0x" + h[:62] + "zz", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseVersionedHash(tt.s)
+		if ok != tt.ok {
+			t.Fatalf("ParseVersionedHash(%q) = %v, want %v", tt.s, ok, tt.ok)
+		}
+		if ok && hex.EncodeToString(got[:]) != h {
+			t.Fatalf("ParseVersionedHash(%q) = %x", tt.s, got)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/memoio/meeda-node/logs"
+)
+
+var ErrNoData = errors.New("field 'data' is not set")
+var ErrIllegalHex = errors.New("field 'data' is not legally hexadecimal presented")
+
+// OpenUpload returns the data of an upload request, which is one of
+//
+//	application/octet-stream  the request body
+//	multipart/form-data       the part named "file" or "data"
+//	application/json          the hex encoded field "data"
+//
+// The other fields are taken from the query, the json fields or the form
+// fields in front of the data part.
+func OpenUpload(r *http.Request) (io.Reader, map[string]string, error) {
+	fields := make(map[string]string)
+	for k, v := range r.URL.Query() {
+		if len(v) > 0 {
+			fields[k] = v[0]
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/octet-stream":
+		return r.Body, fields, nil
+	case "multipart/form-data":
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, nil, err
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil, nil, ErrNoData
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			name := part.FormName()
+			if name == "file" || name == "data" {
+				if part.FileName() != "" {
+					fields["filename"] = part.FileName()
+				}
+				if ct := part.Header.Get("Content-Type"); ct != "" {
+					fields["content-type"] = ct
+				}
+				return part, fields, nil
+			}
+			value, err := io.ReadAll(io.LimitReader(part, 1<<20))
+			if err != nil {
+				return nil, nil, err
+			}
+			fields[name] = string(value)
+		}
+	default:
+		body := make(map[string]interface{})
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range body {
+			if s, ok := v.(string); ok && k != "data" {
+				fields[k] = s
+			}
+		}
+		// the tags may be given as an object
+		if tags, ok := body["tags"].(map[string]interface{}); ok {
+			b, err := json.Marshal(tags)
+			if err != nil {
+				return nil, nil, err
+			}
+			fields["tags"] = string(b)
+		}
+		data, ok := body["data"].(string)
+		if !ok {
+			return nil, nil, ErrNoData
+		}
+		databyte, err := hex.DecodeString(data)
+		if err != nil {
+			return nil, nil, ErrIllegalHex
+		}
+		return bytes.NewReader(databyte), fields, nil
+	}
+}
+
+// ReceiveUpload spools the data of an upload request which is at most limit
+// bytes, the errors returned are logs errors
+func ReceiveUpload(w http.ResponseWriter, r *http.Request, limit int64) (*SpooledData, map[string]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/octet-stream" && r.ContentLength > limit {
+		return nil, nil, logs.DataTooLarge{Size: r.ContentLength, Limit: limit}
+	}
+	// the hex encoded json doubles the size of data
+	r.Body = http.MaxBytesReader(w, r.Body, 2*limit+1<<20)
+
+	reader, fields, err := OpenUpload(r)
+	if err != nil {
+		return nil, nil, uploadError(err, limit)
+	}
+
+	// stage the data on disk, it is committed while being received
+	data, err := Spool(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, nil, uploadError(err, limit)
+	}
+	if data.Size > limit {
+		data.Close()
+		return nil, nil, logs.DataTooLarge{Size: -1, Limit: limit}
+	}
+	return data, fields, nil
+}
+
+func uploadError(err error, limit int64) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return logs.DataTooLarge{Size: -1, Limit: limit}
+	}
+	return logs.ServerError{Message: err.Error()}
+}
+
+// Splitter packs the bytes written into it into field elements the same
+// way as SplitData, so data can be committed while it is streamed
+type Splitter struct {
+	elements []fr.Element
+	buf      [ShardingLen]byte
+	n        int
+}
+
+func (s *Splitter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		copied := copy(s.buf[s.n:], p)
+		s.n += copied
+		p = p[copied:]
+		if s.n == ShardingLen {
+			s.flush()
+		}
+	}
+	return n, nil
+}
+
+func (s *Splitter) flush() {
+	var res [4]fr.Element
+	Pad127(s.buf[:s.n], res[:])
+	s.elements = append(s.elements, res[:]...)
+	s.n = 0
+}
+
+// Elements returns the elements of the data written, the last chunk is
+// padded with zeros
+func (s *Splitter) Elements() []fr.Element {
+	if s.n > 0 || len(s.elements) == 0 {
+		s.flush()
+	}
+	return s.elements
+}
+
+// SpooledData is an upload staged in a temporary file, with the values
+// computed over it while it is written
+type SpooledData struct {
+	file     *os.File
+	kept     bool
+	Size     int64
+	Hash     []byte
+	Elements []fr.Element
+}
+
+// Spool copies r into a temporary file, computing its keccak256 hash and
+// field elements on the fly
+func Spool(r io.Reader) (*SpooledData, error) {
+	file, err := os.CreateTemp("", "meeda-upload-")
+	if err != nil {
+		return nil, err
+	}
+	sd := &SpooledData{file: file}
+
+	hasher := crypto.NewKeccakState()
+	var splitter Splitter
+	sd.Size, err = io.Copy(io.MultiWriter(file, hasher, &splitter), r)
+	if err != nil {
+		sd.Close()
+		return nil, err
+	}
+
+	sd.Hash = hasher.Sum(nil)
+	sd.Elements = splitter.Elements()
+	return sd, nil
+}
+
+// LoadSpooled reopens the data kept at path by Keep
+func LoadSpooled(path string) (*SpooledData, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sd := &SpooledData{file: file}
+
+	hasher := crypto.NewKeccakState()
+	var splitter Splitter
+	sd.Size, err = io.Copy(io.MultiWriter(hasher, &splitter), file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	sd.Hash = hasher.Sum(nil)
+	sd.Elements = splitter.Elements()
+	return sd, nil
+}
+
+// Keep moves the spooled data to path, the data kept is not removed by
+// Close and can be loaded again by LoadSpooled
+func (sd *SpooledData) Keep(path string) error {
+	err := os.Rename(sd.file.Name(), path)
+	if err != nil {
+		// the temporary directory may be on another device
+		err = copyFile(sd.file, path)
+		if err != nil {
+			return err
+		}
+		os.Remove(sd.file.Name())
+	}
+	sd.kept = true
+	return sd.file.Close()
+}
+
+func copyFile(src *os.File, path string) error {
+	_, err := src.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// Reader returns a reader of the spooled data from the beginning
+func (sd *SpooledData) Reader() (io.Reader, error) {
+	_, err := sd.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return io.LimitReader(sd.file, sd.Size), nil
+}
+
+// Section returns a reader of n bytes of the spooled data from off
+func (sd *SpooledData) Section(off, n int64) io.ReadSeeker {
+	return io.NewSectionReader(sd.file, off, n)
+}
+
+func (sd *SpooledData) Close() error {
+	if sd.kept {
+		return nil
+	}
+	sd.file.Close()
+	return os.Remove(sd.file.Name())
+}
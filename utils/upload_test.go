@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSplitterMatchesSplitData(t *testing.T) {
+	sizes := []int{0, 1, ShardingLen - 1, ShardingLen, ShardingLen + 1, 2*ShardingLen - 1, 2 * ShardingLen, 2*ShardingLen + 1, 10 * ShardingLen}
+	// the sizes of the writes into the splitter
+	writes := []int{1, 31, ShardingLen, 1000}
+
+	for _, size := range sizes {
+		data := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(data)
+		want := SplitData(append([]byte(nil), data...))
+
+		for _, write := range writes {
+			var s Splitter
+			for rest := data; len(rest) > 0; {
+				n := write
+				if n > len(rest) {
+					n = len(rest)
+				}
+				s.Write(rest[:n])
+				rest = rest[n:]
+			}
+
+			got := s.Elements()
+			if len(got) != len(want) {
+				t.Fatalf("size %d, writes of %d: %d elements, want %d", size, write, len(got), len(want))
+			}
+			for i := range want {
+				if !got[i].Equal(&want[i]) {
+					t.Fatalf("size %d, writes of %d: element %d differs", size, write, i)
+				}
+			}
+		}
+	}
+}